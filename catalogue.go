@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CatalogueColumns the columns of the rule catalogue, in the order they are written
+var CatalogueColumns = []string{"probe", "service", "kind", "product", "version", "info", "os", "devicetype", "cpe", "line"}
+
+// CatalogueEntry a match rule as listed in the rule catalogue. Version info
+// fields and CPEs keep their templates, such as `$1`, as they are filled per
+// response.
+type CatalogueEntry struct {
+	Probe      string   `json:"probe"`
+	Service    string   `json:"service"`
+	Soft       bool     `json:"soft"`
+	Product    string   `json:"product,omitempty"`
+	Version    string   `json:"version,omitempty"`
+	Info       string   `json:"info,omitempty"`
+	OS         string   `json:"os,omitempty"`
+	DeviceType string   `json:"deviceType,omitempty"`
+	CPEs       []string `json:"cpes,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Line       int      `json:"line,omitempty"`
+}
+
+// Record returns the values of the entry in the order of CatalogueColumns
+func (e *CatalogueEntry) Record() []string {
+	kind := "hard"
+	if e.Soft {
+		kind = "soft"
+	}
+	line := ""
+	if e.Line > 0 {
+		line = strconv.Itoa(e.Line)
+	}
+
+	return []string{e.Probe, e.Service, kind, e.Product, e.Version, e.Info, e.OS, e.DeviceType, strings.Join(e.CPEs, " "), line}
+}
+
+// Catalogue lists every match rule of the database in file order
+func Catalogue(db *ProbeDB) []*CatalogueEntry {
+	var entries []*CatalogueEntry
+	db.EachMatch(func(p *Probe, m *Match) bool {
+		e := &CatalogueEntry{
+			Probe:   p.Protocol + " " + p.ProbeName,
+			Service: m.Name,
+			Soft:    m.Soft,
+			Source:  m.Source,
+			Line:    m.Line,
+		}
+		if v := m.VersionInfo; v != nil {
+			e.Product, e.Version, e.Info = v.VendorProductName, v.Version, v.Info
+			e.OS, e.DeviceType = v.OperatingSystem, v.DeviceType
+			e.CPEs = formatCPEURIs(v)
+		}
+		entries = append(entries, e)
+		return true
+	})
+
+	return entries
+}
+
+// WriteCatalogueCSV writes the rule catalogue as CSV with a header row
+func WriteCatalogueCSV(w io.Writer, db *ProbeDB) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CatalogueColumns); err != nil {
+		return err
+	}
+	for _, e := range Catalogue(db) {
+		if err := cw.Write(e.Record()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WriteCatalogueMarkdown writes the rule catalogue as a Markdown table
+func WriteCatalogueMarkdown(w io.Writer, db *ProbeDB) error {
+	var sb strings.Builder
+	writeMarkdownRow(&sb, CatalogueColumns)
+	fmt.Fprintf(&sb, "|%s\n", strings.Repeat(" --- |", len(CatalogueColumns)))
+	for _, e := range Catalogue(db) {
+		writeMarkdownRow(&sb, e.Record())
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+var markdownCellReplacer = strings.NewReplacer("\\", "\\\\", "|", "\\|", "\r", "", "\n", "<br>")
+
+func writeMarkdownRow(sb *strings.Builder, cells []string) {
+	sb.WriteString("|")
+	for _, cell := range cells {
+		sb.WriteString(" " + markdownCellReplacer.Replace(cell) + " |")
+	}
+	sb.WriteString("\n")
+}
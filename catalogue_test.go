@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const catalogueSrc = `Probe TCP NULL q||
+match ftp m|^220 ([\w.]+) FTP| p/$1/ o/Unix|Linux/ cpe:/a:acme:ftpd/
+softmatch smtp m|^220 .* ESMTP|
+match ssh m|^SSH-([\d.]+)-OpenSSH_([\w._-]+)\r?\n| p/OpenSSH/ v/$SUBST(2,"_",".")/ cpe:/a:openbsd:openssh:$SUBST(2,"_",".")/a
+`
+
+func TestWriteCatalogueCSV(t *testing.T) {
+	db, err := client.ParseProbeDBReader(strings.NewReader(catalogueSrc), "catalogue")
+	assert.Nil(t, err)
+
+	var sb strings.Builder
+	assert.Nil(t, WriteCatalogueCSV(&sb, db))
+	records, err := csv.NewReader(strings.NewReader(sb.String())).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		CatalogueColumns,
+		{"TCP NULL", "ftp", "hard", "$1", "", "", "Unix|Linux", "", "cpe:/a:acme:ftpd", "2"},
+		{"TCP NULL", "smtp", "soft", "", "", "", "", "", "", "3"},
+		{"TCP NULL", "ssh", "hard", "OpenSSH", `$SUBST(2,"_",".")`, "", "", "", `cpe:/a:openbsd:openssh:$SUBST(2,"_",".")/a`, "4"},
+	}, records)
+}
+
+func TestWriteCatalogueMarkdown(t *testing.T) {
+	db, err := client.ParseProbeDBReader(strings.NewReader(catalogueSrc), "catalogue")
+	assert.Nil(t, err)
+
+	var sb strings.Builder
+	assert.Nil(t, WriteCatalogueMarkdown(&sb, db))
+	lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+	assert.Equal(t, "| probe | service | kind | product | version | info | os | devicetype | cpe | line |", lines[0])
+	assert.Equal(t, "| --- | --- | --- | --- | --- | --- | --- | --- | --- | --- |", lines[1])
+	assert.Equal(t, `| TCP NULL | ftp | hard | $1 |  |  | Unix\|Linux |  | cpe:/a:acme:ftpd | 2 |`, lines[2])
+	assert.Len(t, lines, 5)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := fs.String("format", "json", "output format: json, jsonl, csv, markdown, probes or snapshot")
+	indent := fs.Bool("indent", false, "indent the json output")
+	output := fs.String("o", "", "output file, stdout by default")
+	protocols := fs.String("protocol", "", "comma separated protocols to keep")
+	probeNames := fs.String("probe", "", "comma separated probe names to keep")
+	services := fs.String("service", "", "comma separated services to keep")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser convert [options] <probe file>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	// checked before the output is created, which truncates it
+	if err := checkFormat(*format, "json", "jsonl", "csv", "markdown", "probes", "snapshot"); err != nil {
+		return fail(err)
+	}
+
+	db, err := client.ParseProbeDB(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	db = db.Filter(parser.ProbeFilter{
+		Protocols:  splitList(strings.ToUpper(*protocols)),
+		ProbeNames: splitList(*probeNames),
+		Services:   splitList(*services),
+	})
+
+	out, closeOut, err := createOutput(*output)
+	if err != nil {
+		return fail(err)
+	}
+	switch *format {
+	case "json":
+		var doc *parser.JSONDocument
+		if doc, err = parser.NewJSONDocument(db); err != nil {
+			break
+		}
+		encoder := json.NewEncoder(out)
+		if *indent {
+			encoder.SetIndent("", "    ")
+		}
+		err = encoder.Encode(doc)
+	case "jsonl":
+		var doc *parser.JSONDocument
+		if doc, err = parser.NewJSONDocument(db); err != nil {
+			break
+		}
+		encoder := json.NewEncoder(out)
+		for _, p := range doc.Probes {
+			if err = encoder.Encode(p); err != nil {
+				break
+			}
+		}
+	case "csv":
+		err = parser.WriteCatalogueCSV(out, db)
+	case "markdown":
+		err = parser.WriteCatalogueMarkdown(out, db)
+	case "probes":
+		err = client.WriteProbeDB(out, db)
+	case "snapshot":
+		err = client.WriteSnapshot(out, db)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		closeOut()
+		return fail(err)
+	}
+	if err = closeOut(); err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
+
+// splitList splits a comma separated flag value, nil when it is empty
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	exitCode := fs.Bool("exit-code", false, "exit with 1 when the files differ")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser diff [options] <old probe file> <new probe file>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	oldDB, err := client.ParseProbeDB(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	newDB, err := client.ParseProbeDB(fs.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+
+	diff := parser.DiffProbeDBs(oldDB, newDB)
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		err = encoder.Encode(diff)
+	case "text":
+		err = diff.WriteText(os.Stdout)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if *exitCode && !diff.IsEmpty() {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	strict := fs.Bool("strict", false, "exit with 1 on warnings too")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser lint [options] <probe file>...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var issues []*parser.LintIssue
+	for _, path := range fs.Args() {
+		fileIssues, err := client.LintNmapServiceProbe(path)
+		if err != nil {
+			return fail(err)
+		}
+		issues = append(issues, fileIssues...)
+	}
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		if err := encoder.Encode(issues); err != nil {
+			return fail(err)
+		}
+	case "text":
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+	default:
+		return fail(fmt.Errorf("unknown format %q", *format))
+	}
+
+	if parser.HasLintErrors(issues) || *strict && len(issues) > 0 {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,92 @@
+// Command nmap-parser works with nmap-service-probes and the other nmap data files from the command line.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+var client parser.IClient = &parser.Client{}
+
+// command a subcommand, run returns the exit code
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+var commands = map[string]*command{
+	"convert": {"convert a probe file to json, jsonl, csv, markdown or probe format", runConvert},
+	"merge":   {"merge several probe files into one", runMerge},
+	"diff":    {"compare two probe files", runDiff},
+	"scan":    {"detect the services of network targets", runScan},
+	"match":   {"identify a captured banner offline", runMatch},
+	"lint":    {"check probe files for mistakes", runLint},
+	"schema":  {"print the JSON Schema of the json format", runSchema},
+	"shadow":  {"find match rules earlier rules make unreachable", runShadow},
+	"osdb":    {"export nmap-os-db fingerprints as json", runOSDB},
+	"osmatch": {"guess the OS of a subject fingerprint offline", runOSMatch},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: nmap-parser <command> [options]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "nmap-parser: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+// fail prints an error and returns the exit code for failures
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "nmap-parser: %v\n", err)
+	return 1
+}
+
+// checkFormat fails for an output format the subcommand does not write
+func checkFormat(format string, formats ...string) error {
+	for _, f := range formats {
+		if f == format {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// createOutput opens the output file, stdout when path is empty or `-`
+func createOutput(path string) (*os.File, func() error, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, file.Close, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const probeFile = "../../tests/nmap-service-probes"
+
+func TestConvertUnknownFormat(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.txt")
+	assert.Nil(t, os.WriteFile(output, []byte("previous output"), 0644))
+
+	// the output is left alone when the format is rejected
+	assert.Equal(t, 1, runConvert([]string{"-format", "bogus", "-o", output, probeFile}))
+	content, err := os.ReadFile(output)
+	assert.Nil(t, err)
+	assert.Equal(t, "previous output", string(content))
+
+	assert.Equal(t, 0, runConvert([]string{"-format", "csv", "-probe", "NULL", "-o", output, probeFile}))
+	content, err = os.ReadFile(output)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "probe,service,kind")
+}
+
+func TestScanExitCode(t *testing.T) {
+	assert.Equal(t, 1, runScan([]string{"-format", "bogus", "-p", "1", probeFile, "127.0.0.1"}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed := ln.Addr().String()
+	ln.Close()
+	assert.Equal(t, 1, runScan([]string{"-format", "jsonl", probeFile, closed}))
+}
+
+const linuxSubject = `TCP/IP fingerprint:
+OS:SCAN(V=7.94%E=4%D=10/19%OT=22%CT=1%CU=31337%PV=Y%DS=1%DC=D%G=Y%TM=6530D0A1
+OS:%P=x86_64-pc-linux-gnu)SEQ(SP=106%GCD=1%ISR=10A%TI=Z%CI=Z%II=I%TS=A)OPS(O1
+OS:=M5B4ST11NW7%O2=M5B4ST11NW7%O3=M5B4NNT11NW7%O4=M5B4ST11NW7%O5=M5B4ST11NW7%O
+OS:6=M5B4ST11)WIN(W1=FE88%W2=FE88%W3=FE88%W4=FE88%W5=FE88%W6=FE88)ECN(R=Y%DF=Y
+OS:%T=40%W=FAF0%O=M5B4NNSNW7%CC=Y%Q=)T1(R=Y%DF=Y%T=40%S=O%A=S+%F=AS%RD=0%Q=)T2
+OS:(R=Y%DF=Y%T=40%W=0%S=Z%A=S%F=AR%O=%RD=0%Q=)T3(R=N)T4(R=Y%DF=Y%T=40%W=0%S=A
+OS:%A=Z%F=R%O=%RD=0%Q=)T5(R=Y%DF=Y%T=40%W=0%S=Z%A=S+%F=AR%O=%RD=0%Q=)T6(R=Y%DF
+OS:=Y%T=40%W=0%S=A%A=Z%F=R%O=%RD=0%Q=)T7(R=Y%DF=Y%T=40%W=0%S=Z%A=S+%F=AR%O=%RD
+OS:=0%Q=)U1(R=Y%DF=N%T=40%IPL=164%UN=0%RIPL=G%RID=G%RIPCK=G%RUCK=G%RUD=G)IE(R=
+OS:Y%DFI=N%T=40%CD=S)
+`
+
+func TestOSMatchFlags(t *testing.T) {
+	subjectFile := filepath.Join(t.TempDir(), "subject")
+	assert.Nil(t, os.WriteFile(subjectFile, []byte(linuxSubject), 0644))
+	run := func(args ...string) int {
+		return runOSMatch(append(args, "-file", subjectFile, "../../tests/nmap-os-db"))
+	}
+
+	assert.Equal(t, 0, run("-min", "0.5", "-format", "json"))
+	for _, args := range [][]string{{"-format", "bogus"}, {"-min", "0"}, {"-min", "1.5"}, {"-min", "-0.5"}, {"-limit", "-1"}} {
+		assert.Equal(t, 1, run(args...), args)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+// matchOutput the json output of the match subcommand
+type matchOutput struct {
+	*parser.MatchResult
+	Protocol  string   `json:"protocol"`
+	ProbeName string   `json:"probeName"`
+	Captures  []string `json:"captures"`
+	CPEs      []string `json:"cpes,omitempty"`
+}
+
+func runMatch(args []string) int {
+	fs := flag.NewFlagSet("match", flag.ExitOnError)
+	probeName := fs.String("probe", "NULL", "name of the probe the banner answers")
+	protocol := fs.String("protocol", "TCP", "protocol of the probe: TCP or UDP")
+	banner := fs.String("banner", "", `banner as an escaped string such as "220 FTP\r\n"`)
+	bannerFile := fs.String("file", "", "file holding the raw banner, stdin when neither -banner nor -file is given")
+	format := fs.String("format", "text", "output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser match [options] <probe file>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var response []byte
+	var err error
+	switch {
+	case *banner != "":
+		response, err = parser.DecodeEscapes(*banner)
+	case *bannerFile != "":
+		response, err = os.ReadFile(*bannerFile)
+	default:
+		response, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	db, err := client.ParseProbeDB(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	probe := db.Probe(strings.ToUpper(*protocol), *probeName)
+	if probe == nil {
+		return fail(fmt.Errorf("no %s probe named %q", strings.ToUpper(*protocol), *probeName))
+	}
+
+	result := db.MatchResponse(probe, response)
+	if result == nil {
+		fmt.Fprintln(os.Stderr, "no match")
+		return 1
+	}
+
+	out := &matchOutput{MatchResult: result, Protocol: result.Probe.Protocol, ProbeName: result.Probe.ProbeName}
+	for _, capture := range result.Captures {
+		out.Captures = append(out.Captures, string(capture))
+	}
+	out.CPEs = result.VersionInfo.CPE22URIs()
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		if err = encoder.Encode(out); err != nil {
+			return fail(err)
+		}
+	case "text":
+		printMatch(out)
+	default:
+		return fail(fmt.Errorf("unknown format %q", *format))
+	}
+
+	return 0
+}
+
+func printMatch(out *matchOutput) {
+	kind := "match"
+	if out.Soft {
+		kind = "softmatch"
+	}
+	m := out.Match
+	fmt.Printf("service: %s\n", out.Service)
+	fmt.Printf("rule:    %s:%d (probe %s %s)\n", m.Source, m.Line, out.Protocol, out.ProbeName)
+	fmt.Printf("         %s %s m|%s|%s\n", kind, m.Name, m.Pattern, m.PatternFlag)
+	for i, capture := range out.Captures[1:] {
+		fmt.Printf("$%d:      %q\n", i+1, capture)
+	}
+
+	v := out.VersionInfo
+	fields := [][2]string{{"product", v.VendorProductName}, {"version", v.Version}, {"info", v.Info},
+		{"hostname", v.Hostname}, {"os", v.OperatingSystem}, {"device", v.DeviceType}}
+	for _, field := range fields {
+		if field[1] != "" {
+			fmt.Printf("%-8s %s\n", field[0]+":", field[1])
+		}
+	}
+	for _, c := range out.CPEs {
+		fmt.Printf("cpe:     %s\n", c)
+	}
+}
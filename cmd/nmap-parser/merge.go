@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	strategy := fs.String("strategy", "append", "same-named probes: append, replace or error")
+	position := fs.String("position", "after", "where appended matches go: after or before the existing ones")
+	output := fs.String("o", "", "output probe file, stdout by default")
+	reportFormat := fs.String("report", "text", "conflict report format on stderr: text, json or none")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser merge [options] <probe file> <probe file>...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := parser.MergeOptions{}
+	var err error
+	if opts.Strategy, err = parser.ParseMergeStrategy(*strategy); err != nil {
+		return fail(err)
+	}
+	if opts.Position, err = parser.ParseMatchPosition(*position); err != nil {
+		return fail(err)
+	}
+
+	dbs := make([]*parser.ProbeDB, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		db, err := client.ParseProbeDB(path)
+		if err != nil {
+			return fail(err)
+		}
+		dbs = append(dbs, db)
+	}
+
+	merged, report, err := parser.MergeProbeDBs(opts, dbs...)
+	if err != nil {
+		return fail(err)
+	}
+
+	switch *reportFormat {
+	case "text":
+		fmt.Fprint(os.Stderr, report.String())
+	case "json":
+		encoder := json.NewEncoder(os.Stderr)
+		encoder.SetIndent("", "    ")
+		if err = encoder.Encode(report); err != nil {
+			return fail(err)
+		}
+	}
+
+	out, closeOut, err := createOutput(*output)
+	if err != nil {
+		return fail(err)
+	}
+	if err = client.WriteProbeDB(out, merged); err != nil {
+		closeOut()
+		return fail(err)
+	}
+	if err = closeOut(); err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
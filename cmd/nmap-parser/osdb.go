@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+func runOSDB(args []string) int {
+	fs := flag.NewFlagSet("osdb", flag.ExitOnError)
+	indent := fs.Bool("indent", false, "indent the json output")
+	output := fs.String("o", "", "output file, stdout by default")
+	vendor := fs.String("vendor", "", "keep fingerprints with a class of this vendor")
+	family := fs.String("family", "", "keep fingerprints with a class of this OS family")
+	deviceType := fs.String("device", "", "keep fingerprints with a class of this device type")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser osdb [options] <nmap-os-db file>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := client.ParseNmapOSDB(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	if *vendor != "" || *family != "" || *deviceType != "" {
+		matches := func(filter, value string) bool {
+			return filter == "" || strings.EqualFold(filter, value)
+		}
+		db = parser.NewOSDB(db.MatchPoints, db.Filter(func(c *parser.OSClass) bool {
+			return matches(*vendor, c.Vendor) && matches(*family, c.Family) && matches(*deviceType, c.DeviceType)
+		}))
+	}
+
+	out, closeOut, err := createOutput(*output)
+	if err != nil {
+		return fail(err)
+	}
+	encoder := json.NewEncoder(out)
+	if *indent {
+		encoder.SetIndent("", "    ")
+	}
+	if err = encoder.Encode(db); err != nil {
+		closeOut()
+		return fail(err)
+	}
+	if err = closeOut(); err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
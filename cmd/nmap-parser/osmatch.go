@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+// osGuessOutput the json output of the osmatch subcommand
+type osGuessOutput struct {
+	Name     string            `json:"name"`
+	Accuracy float64           `json:"accuracy"`
+	Score    int               `json:"score"`
+	Possible int               `json:"possible"`
+	Classes  []*parser.OSClass `json:"classes"`
+	Line     int               `json:"line"`
+}
+
+func runOSMatch(args []string) int {
+	fs := flag.NewFlagSet("osmatch", flag.ExitOnError)
+	subjectFile := fs.String("file", "", "file holding the subject fingerprint, stdin by default")
+	minAccuracy := fs.Float64("min", parser.DefaultOSMinAccuracy, "lowest accuracy of the guesses, above 0 and up to 1")
+	limit := fs.Int("limit", 10, "most guesses printed, all when 0")
+	format := fs.String("format", "text", "output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser osmatch [options] <nmap-os-db file>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if err := checkFormat(*format, "text", "json"); err != nil {
+		return fail(err)
+	}
+	if *minAccuracy <= 0 || *minAccuracy > 1 {
+		return fail(fmt.Errorf("-min %v is not above 0 and up to 1", *minAccuracy))
+	}
+	if *limit < 0 {
+		return fail(fmt.Errorf("-limit %d is negative", *limit))
+	}
+
+	var data []byte
+	var err error
+	if *subjectFile != "" {
+		data, err = os.ReadFile(*subjectFile)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	subject, err := parser.ParseOSSubject(string(data))
+	if err != nil {
+		return fail(err)
+	}
+
+	db, err := client.ParseNmapOSDB(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	guesses := db.Guess(subject, parser.OSGuessOptions{MinAccuracy: *minAccuracy, Limit: *limit})
+	if len(guesses) == 0 {
+		fmt.Fprintln(os.Stderr, "no OS guess")
+		return 1
+	}
+
+	switch *format {
+	case "json":
+		out := make([]*osGuessOutput, len(guesses))
+		for i, g := range guesses {
+			out[i] = &osGuessOutput{Name: g.Fingerprint.Name, Accuracy: g.Accuracy, Score: g.Score,
+				Possible: g.Possible, Classes: g.Fingerprint.Classes, Line: g.Fingerprint.Line}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		if err = encoder.Encode(out); err != nil {
+			return fail(err)
+		}
+	case "text":
+		for _, g := range guesses {
+			fmt.Printf("%5.1f%%\t%s\n", g.Accuracy*100, g.Fingerprint.Name)
+		}
+	}
+
+	return 0
+}
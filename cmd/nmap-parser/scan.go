@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	ports := fs.String("p", "", "ports for targets given without one, such as 22,80,8000-8010")
+	inputList := fs.String("iL", "", "file of targets, one per line")
+	protocol := fs.String("protocol", "TCP", "protocol of the ports: TCP or UDP")
+	intensity := fs.Int("intensity", parser.DefaultIntensity, "probes with a higher rarity are skipped unless they list the port, 0-9")
+	connectTimeout := fs.Duration("connect-timeout", parser.DefaultConnectTimeout, "timeout of each connection")
+	readTimeout := fs.Duration("read-timeout", 0, "cap on how long each probe waits for a response")
+	concurrency := fs.Int("concurrency", 16, "targets scanned at once")
+	useTLS := fs.Bool("tls", false, "probe again over TLS when a port speaks SSL/TLS")
+	format := fs.String("format", "text", "output format: text, json or jsonl")
+	servicesFile := fs.String("services", "", "nmap-services file naming ports no rule identifies")
+	rpcFile := fs.String("rpc", "", "nmap-rpc file naming the RPC programs of rpcbind ports")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser scan [options] <probe file> [host:port | host | cidr]...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 || *concurrency < 1 || *intensity < 0 || *intensity > 9 {
+		fs.Usage()
+		return 2
+	}
+	if err := checkFormat(*format, "text", "json", "jsonl"); err != nil {
+		return fail(err)
+	}
+
+	specs := fs.Args()[1:]
+	if *inputList != "" {
+		listed, err := readTargetList(*inputList)
+		if err != nil {
+			return fail(err)
+		}
+		specs = append(specs, listed...)
+	}
+	targets, err := parseTargets(specs, *ports, strings.ToUpper(*protocol))
+	if err != nil {
+		return fail(err)
+	}
+	if len(targets) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := client.ParseProbeDB(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	var services *parser.ServicesTable
+	if *servicesFile != "" {
+		if services, err = client.ParseNmapServices(*servicesFile); err != nil {
+			return fail(err)
+		}
+	}
+	var rpc *parser.RPCTable
+	if *rpcFile != "" {
+		if rpc, err = client.ParseNmapRPC(*rpcFile); err != nil {
+			return fail(err)
+		}
+	}
+	detector := parser.NewDetector(db, parser.DetectOptions{
+		Intensity:      intensity,
+		ConnectTimeout: *connectTimeout,
+		ReadTimeout:    *readTimeout,
+		TLS:            *useTLS,
+		Services:       services,
+		RPC:            rpc,
+	})
+
+	detections := make([]*parser.Detection, len(targets))
+	var mu sync.Mutex
+	encoder := json.NewEncoder(os.Stdout)
+	report := func(i int, detection *parser.Detection) {
+		mu.Lock()
+		defer mu.Unlock()
+		detections[i] = detection
+		switch *format {
+		case "jsonl":
+			_ = encoder.Encode(detection)
+		case "text":
+			printDetection(detection)
+		}
+	}
+
+	jobs := make(chan int)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				detection, err := detector.Detect(context.Background(), targets[i])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "nmap-parser: %s: %v\n", targets[i].Address(), err)
+					failed.Store(true)
+					continue
+				}
+				report(i, detection)
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if *format == "json" {
+		found := make([]*parser.Detection, 0, len(detections))
+		for _, detection := range detections {
+			if detection != nil {
+				found = append(found, detection)
+			}
+		}
+		encoder.SetIndent("", "    ")
+		if err = encoder.Encode(found); err != nil {
+			return fail(err)
+		}
+	}
+	// the targets that could be scanned are reported, the exit code tells
+	// that some could not
+	if failed.Load() {
+		return 1
+	}
+
+	return 0
+}
+
+func printDetection(d *parser.Detection) {
+	service := d.Service
+	switch {
+	case d.Excluded:
+		service = "excluded"
+	case service == "":
+		service = "unknown"
+	}
+	if d.Soft || d.Guessed {
+		service += "?"
+	}
+
+	var version []string
+	if v := d.VersionInfo; v != nil {
+		for _, field := range []string{v.VendorProductName, v.Version} {
+			if field != "" {
+				version = append(version, field)
+			}
+		}
+		if v.Info != "" {
+			version = append(version, "("+v.Info+")")
+		}
+	}
+	if d.RPC != nil {
+		version = append(version, d.RPC.String())
+	}
+	fmt.Printf("%s/%s\t%s\t%s\n", d.Address(), strings.ToLower(d.Protocol), service, strings.Join(version, " "))
+}
+
+// readTargetList reads the targets of a file, skipping blank lines and # comments
+func readTargetList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var specs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			specs = append(specs, strings.Fields(line)...)
+		}
+	}
+
+	return specs, scanner.Err()
+}
+
+// parseTargets expands host:port, host and CIDR specifications, the latter
+// two with the ports of the -p option
+func parseTargets(specs []string, ports, protocol string) ([]parser.Target, error) {
+	portList, err := parsePorts(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []parser.Target
+	for _, spec := range specs {
+		if host, port, err := net.SplitHostPort(spec); err == nil {
+			n, err := strconv.Atoi(port)
+			if err != nil || n < 1 || n > 65535 {
+				return nil, fmt.Errorf("invalid port in target %q", spec)
+			}
+			targets = append(targets, parser.Target{Protocol: protocol, Host: host, Port: n})
+			continue
+		}
+
+		if len(portList) == 0 {
+			return nil, fmt.Errorf("target %q has no port, use host:port or -p", spec)
+		}
+		hosts := []string{spec}
+		if strings.Contains(spec, "/") {
+			if hosts, err = expandCIDR(spec); err != nil {
+				return nil, err
+			}
+		}
+		for _, host := range hosts {
+			for _, port := range portList {
+				targets = append(targets, parser.Target{Protocol: protocol, Host: host, Port: port})
+			}
+		}
+	}
+
+	return targets, nil
+}
+
+// parsePorts parses a list such as 22,80,8000-8010
+func parsePorts(s string) (ports []int, err error) {
+	for _, item := range splitList(s) {
+		low, high := item, item
+		if i := strings.IndexByte(item, '-'); i != -1 {
+			low, high = item[:i], item[i+1:]
+		}
+		l, errLow := strconv.Atoi(low)
+		h, errHigh := strconv.Atoi(high)
+		if errLow != nil || errHigh != nil || l < 1 || h > 65535 || l > h {
+			return nil, fmt.Errorf("invalid port %q", item)
+		}
+		for port := l; port <= h; port++ {
+			ports = append(ports, port)
+		}
+	}
+
+	return ports, nil
+}
+
+// expandCIDR returns every address of a network
+func expandCIDR(cidr string) ([]string, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ones, bits := network.Mask.Size(); bits-ones > 16 {
+		return nil, fmt.Errorf("network %s is too large", cidr)
+	}
+
+	var hosts []string
+	for ip = ip.Mask(network.Mask); network.Contains(ip); ip = nextIP(ip) {
+		hosts = append(hosts, ip.String())
+	}
+
+	return hosts, nil
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP(nil), ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	return next
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+func runSchema(args []string) int {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	output := fs.String("o", "", "output file, stdout by default")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser schema [options]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	schema, err := parser.JSONSchema()
+	if err != nil {
+		return fail(err)
+	}
+
+	out, closeOut, err := createOutput(*output)
+	if err != nil {
+		return fail(err)
+	}
+	if _, err = out.Write(schema); err != nil {
+		closeOut()
+		return fail(err)
+	}
+	if err = closeOut(); err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+func runShadow(args []string) int {
+	fs := flag.NewFlagSet("shadow", flag.ExitOnError)
+	samples := fs.Int("samples", parser.DefaultShadowSamples, "strings generated from each pattern")
+	banners := fs.String("banners", "", "directory of test banners, one raw response per file")
+	format := fs.String("format", "text", "output format: text or json")
+	exitCode := fs.Bool("exit-code", false, "exit with 1 when shadowed rules are found")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmap-parser shadow [options] <probe file>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := client.ParseProbeDB(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	opts := parser.ShadowOptions{Samples: *samples}
+	if *banners != "" {
+		if opts.Banners, err = readBanners(*banners); err != nil {
+			return fail(err)
+		}
+	}
+
+	shadowed := parser.FindShadowedRules(db, opts)
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		if err = encoder.Encode(shadowed); err != nil {
+			return fail(err)
+		}
+	case "text":
+		for _, s := range shadowed {
+			fmt.Printf("%s (%d samples)\n", s, s.Samples)
+		}
+	default:
+		return fail(fmt.Errorf("unknown format %q", *format))
+	}
+
+	if *exitCode && len(shadowed) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// readBanners reads every regular file of the directory as one banner
+func readBanners(dir string) ([][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var banners [][]byte
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		banner, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		banners = append(banners, banner)
+	}
+
+	return banners, nil
+}
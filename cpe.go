@@ -0,0 +1,225 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/randolphcyg/cpe"
+)
+
+const (
+	cpeAny = "*"
+	cpeNA  = "-"
+)
+
+// CPE22URIs render all CPEs of the version info as CPE 2.2 URI bindings
+func (v *VInfo) CPE22URIs() []string {
+	uris := make([]string, 0, len(v.Cpe))
+	for _, c := range v.Cpe {
+		if c == nil || c.IsEmpty() {
+			continue
+		}
+		uris = append(uris, FormatCPE22URI(c))
+	}
+
+	return uris
+}
+
+// CPE23Strings render all CPEs of the version info as CPE 2.3 formatted strings
+func (v *VInfo) CPE23Strings() []string {
+	names := make([]string, 0, len(v.Cpe))
+	for _, c := range v.Cpe {
+		if c == nil || c.IsEmpty() {
+			continue
+		}
+		names = append(names, FormatCPE23(c))
+	}
+
+	return names
+}
+
+// cpeAttributes returns the eleven WFN attributes of the CPE in binding order
+func cpeAttributes(c *cpe.CPE) []string {
+	return []string{
+		c.Part, c.Vendor, c.Product, c.Version, c.Update, c.Edition,
+		c.Language, c.SwEdition, c.TargetSw, c.TargetHw, c.Other,
+	}
+}
+
+// normalizeCPEValue turns a raw CPE attribute into its logical value:
+// empty and "*" mean ANY, "-" means NA, anything else is unescaped text.
+// Values filled from banners may still carry URI percent-encoding from the
+// nmap template (e.g. `%2E`), which is decoded here.
+func normalizeCPEValue(v string) string {
+	v = strings.TrimSpace(v)
+	switch v {
+	case "", cpeAny:
+		return cpeAny
+	case cpeNA:
+		return cpeNA
+	}
+
+	return decodePercent(v)
+}
+
+// decodePercent decodes valid `%xx` sequences and leaves everything else as is
+func decodePercent(v string) string {
+	if strings.IndexByte(v, '%') == -1 {
+		return v
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '%' && i+2 < len(v) && isHexDigit(v[i+1]) && isHexDigit(v[i+2]) {
+			sb.WriteByte(unhex(v[i+1])<<4 | unhex(v[i+2]))
+			i += 2
+			continue
+		}
+		sb.WriteByte(v[i])
+	}
+
+	return sb.String()
+}
+
+func isHexDigit(b byte) bool {
+	return '0' <= b && b <= '9' || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F'
+}
+
+func unhex(b byte) byte {
+	switch {
+	case '0' <= b && b <= '9':
+		return b - '0'
+	case 'a' <= b && b <= 'f':
+		return b - 'a' + 10
+	default:
+		return b - 'A' + 10
+	}
+}
+
+// isCPEUnreservedByte reports whether b may appear unquoted in a CPE binding
+func isCPEUnreservedByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+		b == '_' || b == '-' || b == '.'
+}
+
+// bindCPE23Value quotes a logical value for the 2.3 formatted string binding
+func bindCPE23Value(v string) string {
+	if v == cpeAny || v == cpeNA {
+		return v
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(v); i++ {
+		b := v[i]
+		switch {
+		case b == ' ' || b == '\t' || b == '\r' || b == '\n':
+			// whitespace is not allowed in a WFN value
+			sb.WriteByte('_')
+		case isCPEUnreservedByte(b) || b >= 0x80:
+			sb.WriteByte(b)
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		}
+	}
+
+	return sb.String()
+}
+
+// bindCPE22Value percent-encodes a logical value for the 2.2 URI binding
+func bindCPE22Value(v string) string {
+	switch v {
+	case cpeAny:
+		return ""
+	case cpeNA:
+		return cpeNA
+	}
+
+	const hexDigits = "0123456789abcdef"
+	var sb strings.Builder
+	for i := 0; i < len(v); i++ {
+		b := v[i]
+		switch {
+		case b == ' ' || b == '\t' || b == '\r' || b == '\n':
+			sb.WriteByte('_')
+		case isCPEUnreservedByte(b):
+			sb.WriteByte(b)
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(hexDigits[b>>4])
+			sb.WriteByte(hexDigits[b&0x0f])
+		}
+	}
+
+	return sb.String()
+}
+
+// FormatCPE23 binds a CPE to a CPE 2.3 formatted string, e.g.
+// `cpe:2.3:a:openbsd:openssh:7.4p1:*:*:*:*:*:*:*`
+func FormatCPE23(c *cpe.CPE) string {
+	attrs := cpeAttributes(c)
+	values := make([]string, len(attrs))
+	for i, attr := range attrs {
+		values[i] = bindCPE23Value(normalizeCPEValue(attr))
+	}
+
+	return cpe.FlagCpe23 + strings.Join(values, ":")
+}
+
+// FormatCPE22URI binds a CPE to a CPE 2.2 URI, e.g. `cpe:/a:openbsd:openssh:7.4p1`.
+// The CPE 2.3 extended attributes are packed into the edition component.
+func FormatCPE22URI(c *cpe.CPE) string {
+	attrs := cpeAttributes(c)
+	values := make([]string, len(attrs))
+	for i, attr := range attrs {
+		values[i] = bindCPE22Value(normalizeCPEValue(attr))
+	}
+
+	return cpe.FlagCpe22 + joinCPE22(values)
+}
+
+// joinCPE22 joins the eleven bound attributes into the body of a 2.2 URI,
+// packing the extended attributes into edition and trimming trailing empty components
+func joinCPE22(values []string) string {
+	edition := values[5]
+	if values[7] != "" || values[8] != "" || values[9] != "" || values[10] != "" {
+		edition = "~" + strings.Join([]string{values[5], values[7], values[8], values[9], values[10]}, "~")
+	}
+
+	components := []string{values[0], values[1], values[2], values[3], values[4], edition, values[6]}
+	end := len(components)
+	for end > 1 && components[end-1] == "" {
+		end--
+	}
+
+	return strings.Join(components[:end], ":")
+}
+
+// parseCPE22Body splits the body of a 2.2 URI (`a:vendor:product:...`) into a CPE,
+// unpacking extended attributes from the edition. Unlike cpe.ParseCPE empty
+// components are accepted, as in `cpe:/a:proftpd:proftpd::::de`.
+func parseCPE22Body(body string) (*cpe.CPE, error) {
+	components := strings.Split(body, ":")
+	if len(components) > 7 {
+		return nil, cpe.ErrInvalidPartTooManyComponents
+	}
+	if !cpe.IsPart(components[0]) {
+		return nil, cpe.ErrInvalidPart
+	}
+
+	values := make([]string, 7)
+	copy(values, components)
+	c := &cpe.CPE{
+		Part: values[0], Vendor: values[1], Product: values[2], Version: values[3],
+		Update: values[4], Edition: values[5], Language: values[6],
+	}
+
+	if strings.HasPrefix(c.Edition, "~") {
+		packed := strings.Split(c.Edition[1:], "~")
+		if len(packed) != 5 {
+			return nil, cpe.ErrInvalidCPE
+		}
+		c.Edition, c.SwEdition, c.TargetSw, c.TargetHw, c.Other = packed[0], packed[1], packed[2], packed[3], packed[4]
+	}
+
+	return c, nil
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/randolphcyg/cpe"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatCPE23(t *testing.T) {
+	c := &cpe.CPE{Part: "a", Vendor: "openbsd", Product: "openssh", Version: "7.4p1"}
+	assert.Equal(t, "cpe:2.3:a:openbsd:openssh:7.4p1:*:*:*:*:*:*:*", FormatCPE23(c))
+
+	c = &cpe.CPE{Part: "o", Vendor: "cisco", Product: "ios", Version: "12.2(55)SE1", Update: "-"}
+	assert.Equal(t, `cpe:2.3:o:cisco:ios:12.2\(55\)SE1:-:*:*:*:*:*:*`, FormatCPE23(c))
+
+	// characters coming from banner captures are escaped
+	c = &cpe.CPE{Part: "a", Vendor: "acme", Product: "web", Version: "1.0:beta/2 rc"}
+	assert.Equal(t, `cpe:2.3:a:acme:web:1.0\:beta\/2_rc:*:*:*:*:*:*:*`, FormatCPE23(c))
+}
+
+func TestFormatCPE22URI(t *testing.T) {
+	c := &cpe.CPE{Part: "a", Vendor: "ibm", Product: "os2_ftp_server", Language: "de"}
+	assert.Equal(t, "cpe:/a:ibm:os2_ftp_server::::de", FormatCPE22URI(c))
+
+	c = &cpe.CPE{Part: "a", Vendor: "acme", Product: "web", Version: "1.0:beta/2"}
+	assert.Equal(t, "cpe:/a:acme:web:1.0%3abeta%2f2", FormatCPE22URI(c))
+
+	c = &cpe.CPE{Part: "a", Vendor: "acme", Product: "web", Version: "*", TargetSw: "linux"}
+	assert.Equal(t, "cpe:/a:acme:web:::~~~linux~~", FormatCPE22URI(c))
+}
+
+func TestVInfoCPEStrings(t *testing.T) {
+	match, err := client.ParseMatch(`match ssh m|^SSH-([\d.]+)-OpenSSH_([\w._-]+)\r?\n| p/OpenSSH/ v/$2/ i/protocol $1/ cpe:/a:openbsd:openssh:$2/`)
+	assert.Nil(t, err)
+
+	src := [][]byte{[]byte("SSH-2.0-OpenSSH_7.4p1\r\n"), []byte("2.0"), []byte("7.4p1")}
+	vInfo := client.FillVersionInfoFields(src, match)
+	assert.Equal(t, []string{"cpe:/a:openbsd:openssh:7.4p1"}, vInfo.CPE22URIs())
+	assert.Equal(t, []string{"cpe:2.3:a:openbsd:openssh:7.4p1:*:*:*:*:*:*:*"}, vInfo.CPE23Strings())
+}
@@ -0,0 +1,499 @@
+package parser
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/randolphcyg/cpe"
+)
+
+// DefaultCPEMatchMinScore the lowest score a dictionary candidate needs to be reported
+const DefaultCPEMatchMinScore = 0.5
+
+var (
+	ErrCPEDictFormat = errors.New("unrecognized CPE dictionary format")
+	ErrCPEDictEmpty  = errors.New("CPE dictionary contains no entries")
+)
+
+// CPEDictEntry an official CPE name of the NVD CPE dictionary
+type CPEDictEntry struct {
+	Name       string   `json:"name"`
+	Title      string   `json:"title,omitempty"`
+	Deprecated bool     `json:"deprecated,omitempty"`
+	Cpe        *cpe.CPE `json:"-"`
+}
+
+// CPEMatch a detected CPE mapped to the best matching dictionary entry
+type CPEMatch struct {
+	Detected *cpe.CPE      `json:"detected"`
+	Entry    *CPEDictEntry `json:"entry"`
+	Score    float64       `json:"score"`
+}
+
+// CPEDictionary an offline NVD CPE dictionary indexed for matching detected CPEs
+type CPEDictionary struct {
+	MinScore float64
+
+	entries   []*CPEDictEntry
+	byProduct map[string][]*CPEDictEntry
+	byToken   map[string][]*CPEDictEntry
+}
+
+// LoadCPEDictionary loads a local NVD CPE dictionary. Both the XML dictionary
+// (official-cpe-dictionary_v2.3.xml) and the JSON feeds (CPE API 2.0 `products`
+// and the legacy 1.0 match feed) are supported, optionally gzip compressed.
+func LoadCPEDictionary(path string) (*CPEDictionary, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadCPEDictionary(file)
+}
+
+// ReadCPEDictionary reads an NVD CPE dictionary, detecting its format from the content
+func ReadCPEDictionary(r io.Reader) (*CPEDictionary, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return nil, errors.WithMessage(err, ErrCPEDictFormat.Error())
+	}
+
+	var entries []*CPEDictEntry
+	switch first {
+	case '<':
+		entries, err = readCPEDictXML(br)
+	case '{':
+		entries, err = readCPEDictJSON(br)
+	default:
+		return nil, ErrCPEDictFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrCPEDictEmpty
+	}
+
+	return NewCPEDictionary(entries), nil
+}
+
+// NewCPEDictionary builds the lookup indexes over the given dictionary entries
+func NewCPEDictionary(entries []*CPEDictEntry) *CPEDictionary {
+	d := &CPEDictionary{
+		MinScore:  DefaultCPEMatchMinScore,
+		byProduct: make(map[string][]*CPEDictEntry),
+		byToken:   make(map[string][]*CPEDictEntry),
+	}
+
+	for _, e := range entries {
+		if e.Cpe == nil {
+			continue
+		}
+		d.entries = append(d.entries, e)
+		key := normalizeCPEName(e.Cpe.Product)
+		d.byProduct[key] = append(d.byProduct[key], e)
+		for _, token := range cpeNameTokens(key) {
+			d.byToken[token] = append(d.byToken[token], e)
+		}
+	}
+
+	return d
+}
+
+// Len returns the number of entries of the dictionary
+func (d *CPEDictionary) Len() int {
+	return len(d.entries)
+}
+
+// Match maps a detected CPE to the best matching official CPE name, nil if no
+// candidate reaches MinScore
+func (d *CPEDictionary) Match(c *cpe.CPE) *CPEMatch {
+	if c == nil || c.IsEmpty() {
+		return nil
+	}
+
+	product := normalizeCPEName(c.Product)
+	candidates := d.byProduct[product]
+	if len(candidates) == 0 {
+		seen := make(map[*CPEDictEntry]struct{})
+		for _, token := range cpeNameTokens(product) {
+			for _, e := range d.byToken[token] {
+				if _, ok := seen[e]; ok {
+					continue
+				}
+				seen[e] = struct{}{}
+				candidates = append(candidates, e)
+			}
+		}
+	}
+
+	var best *CPEMatch
+	for _, e := range candidates {
+		score := scoreCPECandidate(c, e)
+		if score < d.MinScore {
+			continue
+		}
+		if best == nil || score > best.Score || score == best.Score && e.Name < best.Entry.Name {
+			best = &CPEMatch{Detected: c, Entry: e, Score: score}
+		}
+	}
+
+	return best
+}
+
+// MatchVInfo maps every CPE of the version info, skipping those without a match
+func (d *CPEDictionary) MatchVInfo(v *VInfo) []*CPEMatch {
+	matches := make([]*CPEMatch, 0, len(v.Cpe))
+	for _, c := range v.Cpe {
+		if m := d.Match(c); m != nil {
+			matches = append(matches, m)
+		}
+	}
+
+	return matches
+}
+
+// scoreCPECandidate rates how well a dictionary entry describes the detected CPE, from 0 to 1
+func scoreCPECandidate(c *cpe.CPE, e *CPEDictEntry) float64 {
+	if c.Part != "" && e.Cpe.Part != "" && c.Part != e.Cpe.Part {
+		return 0
+	}
+
+	vendor := cpeNameSimilarity(c.Vendor, e.Cpe.Vendor)
+	product := cpeNameSimilarity(c.Product, e.Cpe.Product)
+	// a product named with a subset of the words of the other, such as http
+	// and http_server, is close enough only under the same vendor
+	if vendor >= 0.95 && cpeNameTokensContained(c.Product, e.Cpe.Product) {
+		product = maxFloat(product, 0.7)
+	}
+	score := 0.3*vendor + 0.45*product
+
+	version := normalizeCPEValue(c.Version)
+	entryVersion := normalizeCPEValue(e.Cpe.Version)
+	switch {
+	case version == cpeAny || version == cpeNA:
+		// a product level name is the best answer for an unversioned detection
+		if entryVersion == cpeAny || entryVersion == cpeNA {
+			score += 0.25
+		}
+	case strings.EqualFold(version, entryVersion):
+		score += 0.25
+	case entryVersion != cpeAny && entryVersion != cpeNA &&
+		(strings.HasPrefix(strings.ToLower(version), strings.ToLower(entryVersion)) ||
+			strings.HasPrefix(strings.ToLower(entryVersion), strings.ToLower(version))):
+		score += 0.15
+	}
+
+	if e.Deprecated {
+		score -= 0.05
+	}
+
+	return score
+}
+
+// cpeNameSimilarity compares two vendor or product names, from 0 to 1
+func cpeNameSimilarity(a, b string) float64 {
+	a, b = normalizeCPEName(a), normalizeCPEName(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	if strings.ReplaceAll(a, "_", "") == strings.ReplaceAll(b, "_", "") {
+		return 0.95
+	}
+
+	ta, tb := cpeNameTokens(a), cpeNameTokens(b)
+	common := 0
+	for _, x := range ta {
+		for _, y := range tb {
+			if x == y {
+				common++
+				break
+			}
+		}
+	}
+
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+// cpeNameTokensContained reports whether every word of one name is a word of
+// the other, unlike a substring ssh is not a word of openssh_server
+func cpeNameTokensContained(a, b string) bool {
+	ta, tb := cpeNameTokens(normalizeCPEName(a)), cpeNameTokens(normalizeCPEName(b))
+	if len(ta) == 0 || len(tb) == 0 {
+		return false
+	}
+	if len(ta) > len(tb) {
+		ta, tb = tb, ta
+	}
+	for _, x := range ta {
+		if !containsString(tb, x) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// normalizeCPEName lower-cases a name and folds every separator into `_`
+func normalizeCPEName(s string) string {
+	s = strings.ToLower(decodePercent(s))
+	var sb strings.Builder
+	lastSep := true
+	for _, r := range s {
+		if 'a' <= r && r <= 'z' || '0' <= r && r <= '9' {
+			sb.WriteRune(r)
+			lastSep = false
+			continue
+		}
+		if !lastSep {
+			sb.WriteByte('_')
+			lastSep = true
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "_")
+}
+
+func cpeNameTokens(normalized string) []string {
+	if normalized == "" {
+		return nil
+	}
+
+	return strings.Split(normalized, "_")
+}
+
+// parseCPE23Name splits a CPE 2.3 formatted string into a CPE, removing the quoting
+func parseCPE23Name(name string) (*cpe.CPE, error) {
+	if !strings.HasPrefix(strings.ToLower(name), cpe.FlagCpe23) {
+		return nil, cpe.ErrCPENonstandard
+	}
+
+	var values []string
+	var sb strings.Builder
+	body := name[len(cpe.FlagCpe23):]
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			if i+1 < len(body) {
+				i++
+				sb.WriteByte(body[i])
+			}
+		case ':':
+			values = append(values, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteByte(body[i])
+		}
+	}
+	values = append(values, sb.String())
+
+	if len(values) != 11 {
+		return nil, cpe.ErrInvalidCPE
+	}
+	if !cpe.IsPart(values[0]) {
+		return nil, cpe.ErrInvalidPart
+	}
+
+	return &cpe.CPE{
+		Part: values[0], Vendor: values[1], Product: values[2], Version: values[3],
+		Update: values[4], Edition: values[5], Language: values[6], SwEdition: values[7],
+		TargetSw: values[8], TargetHw: values[9], Other: values[10],
+	}, nil
+}
+
+// newCPEDictEntry builds an entry from a 2.3 name, or a 2.2 URI when the former is missing
+func newCPEDictEntry(name23, name22, title string, deprecated bool) *CPEDictEntry {
+	e := &CPEDictEntry{Title: title, Deprecated: deprecated}
+	if name23 != "" {
+		c, err := parseCPE23Name(name23)
+		if err != nil {
+			return nil
+		}
+		e.Name, e.Cpe = name23, c
+		return e
+	}
+
+	c, err := cpe.ParseCPE(name22)
+	if err != nil {
+		return nil
+	}
+	e.Name, e.Cpe = FormatCPE23(c), c
+
+	return e
+}
+
+type cpeDictTitle struct {
+	Lang  string `xml:"lang,attr" json:"lang"`
+	Value string `xml:",chardata" json:"title"`
+}
+
+// englishTitle picks the English title, falling back to the first one
+func englishTitle(titles []cpeDictTitle) string {
+	for _, t := range titles {
+		if strings.HasPrefix(strings.ToLower(t.Lang), "en") {
+			return strings.TrimSpace(t.Value)
+		}
+	}
+	if len(titles) > 0 {
+		return strings.TrimSpace(titles[0].Value)
+	}
+
+	return ""
+}
+
+func readCPEDictXML(r io.Reader) (entries []*CPEDictEntry, err error) {
+	type xmlCPEItem struct {
+		Name       string         `xml:"name,attr"`
+		Deprecated bool           `xml:"deprecated,attr"`
+		Titles     []cpeDictTitle `xml:"title"`
+		Cpe23      struct {
+			Name string `xml:"name,attr"`
+		} `xml:"cpe23-item"`
+	}
+
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "cpe-item" {
+			continue
+		}
+
+		item := xmlCPEItem{}
+		if err = decoder.DecodeElement(&item, &start); err != nil {
+			return nil, err
+		}
+		if e := newCPEDictEntry(item.Cpe23.Name, item.Name, englishTitle(item.Titles), item.Deprecated); e != nil {
+			entries = append(entries, e)
+		}
+	}
+}
+
+func readCPEDictJSON(r io.Reader) (entries []*CPEDictEntry, err error) {
+	type apiProduct struct {
+		Cpe struct {
+			CpeName    string         `json:"cpeName"`
+			Deprecated bool           `json:"deprecated"`
+			Titles     []cpeDictTitle `json:"titles"`
+		} `json:"cpe"`
+	}
+	type feedMatch struct {
+		Cpe23Uri string `json:"cpe23Uri"`
+		CpeName  []struct {
+			Cpe23Uri string `json:"cpe23Uri"`
+		} `json:"cpe_name"`
+	}
+
+	decoder := json.NewDecoder(r)
+	if _, err = decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	add := func(e *CPEDictEntry) {
+		if e == nil {
+			return
+		}
+		if _, ok := seen[e.Name]; ok {
+			return
+		}
+		seen[e.Name] = struct{}{}
+		entries = append(entries, e)
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+
+		if key != "products" && key != "matches" {
+			var skip json.RawMessage
+			if err = decoder.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, err = decoder.Token(); err != nil {
+			return nil, err
+		}
+		for decoder.More() {
+			if key == "products" {
+				p := apiProduct{}
+				if err = decoder.Decode(&p); err != nil {
+					return nil, err
+				}
+				add(newCPEDictEntry(p.Cpe.CpeName, "", englishTitle(p.Cpe.Titles), p.Cpe.Deprecated))
+				continue
+			}
+
+			m := feedMatch{}
+			if err = decoder.Decode(&m); err != nil {
+				return nil, err
+			}
+			for _, n := range m.CpeName {
+				add(newCPEDictEntry(n.Cpe23Uri, "", "", false))
+			}
+		}
+		if _, err = decoder.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// peekNonSpace skips leading white space and a UTF-8 BOM, returning the next byte unread
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n', 0xef, 0xbb, 0xbf:
+			continue
+		}
+
+		return b, br.UnreadByte()
+	}
+}
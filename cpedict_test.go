@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/randolphcyg/cpe"
+	"github.com/stretchr/testify/assert"
+)
+
+const cpeDictXML = `<?xml version="1.0" encoding="UTF-8"?>
+<cpe-list xmlns="http://cpe.mitre.org/dictionary/2.0" xmlns:cpe-23="http://scap.nist.gov/schema/cpe-extension/2.3">
+  <cpe-item name="cpe:/a:openbsd:openssh:7.4p1">
+    <title xml:lang="en-US">OpenBSD OpenSSH 7.4p1</title>
+    <cpe-23:cpe23-item name="cpe:2.3:a:openbsd:openssh:7.4p1:*:*:*:*:*:*:*"/>
+  </cpe-item>
+  <cpe-item name="cpe:/a:openbsd:openssh:7.4">
+    <title xml:lang="en-US">OpenBSD OpenSSH 7.4</title>
+    <cpe-23:cpe23-item name="cpe:2.3:a:openbsd:openssh:7.4:*:*:*:*:*:*:*"/>
+  </cpe-item>
+  <cpe-item name="cpe:/a:apache:http_server:2.4.29">
+    <title xml:lang="en-US">Apache Software Foundation Apache HTTP Server 2.4.29</title>
+    <cpe-23:cpe23-item name="cpe:2.3:a:apache:http_server:2.4.29:*:*:*:*:*:*:*"/>
+  </cpe-item>
+</cpe-list>`
+
+const cpeDictJSON = `{"resultsPerPage":2,"format":"NVD_CPE","products":[
+  {"cpe":{"deprecated":false,"cpeName":"cpe:2.3:a:redis:redis:-:*:*:*:*:*:*:*","titles":[{"title":"Redis","lang":"en"}]}},
+  {"cpe":{"deprecated":false,"cpeName":"cpe:2.3:a:redis:redis:6.0.9:*:*:*:*:*:*:*","titles":[{"title":"Redis 6.0.9","lang":"en"}]}}
+]}`
+
+func TestCPEDictionaryXML(t *testing.T) {
+	dict, err := ReadCPEDictionary(strings.NewReader(cpeDictXML))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, dict.Len())
+
+	m := dict.Match(&cpe.CPE{Part: "a", Vendor: "openbsd", Product: "openssh", Version: "7.4p1"})
+	assert.NotNil(t, m)
+	assert.Equal(t, "cpe:2.3:a:openbsd:openssh:7.4p1:*:*:*:*:*:*:*", m.Entry.Name)
+	assert.Equal(t, "OpenBSD OpenSSH 7.4p1", m.Entry.Title)
+	assert.InDelta(t, 1.0, m.Score, 1e-9)
+
+	// guessed product names still map to the official one
+	m = dict.Match(&cpe.CPE{Part: "a", Vendor: "apache", Product: "httpd-server", Version: "2.4.29"})
+	assert.NotNil(t, m)
+	assert.Equal(t, "cpe:2.3:a:apache:http_server:2.4.29:*:*:*:*:*:*:*", m.Entry.Name)
+
+	assert.Nil(t, dict.Match(&cpe.CPE{Part: "a", Vendor: "microsoft", Product: "iis"}))
+}
+
+func TestCPEDictionaryPartialNames(t *testing.T) {
+	dict, err := ReadCPEDictionary(strings.NewReader(`<cpe-list>
+  <cpe-item name="cpe:/a:debian:openssh-server:1%3a9.2p1-2"><title>Debian OpenSSH server</title></cpe-item>
+  <cpe-item name="cpe:/a:apache:http_server:2.4.29"><title>Apache HTTP Server 2.4.29</title></cpe-item>
+</cpe-list>`))
+	assert.Nil(t, err)
+
+	// a name holding the words of the other matches under the same vendor
+	m := dict.Match(&cpe.CPE{Part: "a", Vendor: "apache", Product: "http", Version: "2.4.29"})
+	if assert.NotNil(t, m) {
+		assert.Equal(t, "cpe:2.3:a:apache:http_server:2.4.29:*:*:*:*:*:*:*", m.Entry.Name)
+	}
+	// but not under another vendor
+	assert.Nil(t, dict.Match(&cpe.CPE{Part: "a", Vendor: "nginx", Product: "http", Version: "2.4.29"}))
+	// and a substring inside a word is not a word: ssh is not openssh
+	assert.Nil(t, dict.Match(&cpe.CPE{Part: "a", Vendor: "debian", Product: "ssh-server"}))
+}
+
+func TestCPEDictionaryJSON(t *testing.T) {
+	dict, err := ReadCPEDictionary(strings.NewReader(cpeDictJSON))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, dict.Len())
+
+	vInfo := &VInfo{Cpe: []*cpe.CPE{{Part: "a", Vendor: "redis", Product: "redis"}}}
+	matches := dict.MatchVInfo(vInfo)
+	assert.Equal(t, 1, len(matches))
+	assert.Equal(t, "cpe:2.3:a:redis:redis:-:*:*:*:*:*:*:*", matches[0].Entry.Name)
+}
+
+func TestCPEDictionaryFormat(t *testing.T) {
+	_, err := ReadCPEDictionary(strings.NewReader("cpe:/a:redis:redis"))
+	assert.ErrorIs(t, err, ErrCPEDictFormat)
+}
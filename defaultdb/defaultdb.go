@@ -0,0 +1,42 @@
+// Package defaultdb embeds a pinned copy of nmap's nmap-service-probes, so
+// programs can detect services without shipping the probe file separately.
+// Importing it adds the probe file to the binary.
+package defaultdb
+
+import (
+	"bytes"
+	_ "embed"
+	"sync"
+
+	parser "github.com/randolphcyg/nmap-parser"
+)
+
+//go:generate go run update.go
+
+// FileName the name the embedded file is reported under, in the Source of
+// probes and rules and in parse errors
+const FileName = "nmap-service-probes"
+
+//go:embed nmap-service-probes
+var probes []byte
+
+var (
+	once sync.Once
+	db   *parser.ProbeDB
+	err  error
+)
+
+// Default returns the embedded probe database, parsed on first call. Every
+// call returns the same database, which callers must not modify.
+func Default() (*parser.ProbeDB, error) {
+	once.Do(func() {
+		db, err = (&parser.Client{}).ParseProbeDBReader(bytes.NewReader(probes), FileName)
+	})
+
+	return db, err
+}
+
+// Bytes returns a copy of the embedded probe file
+func Bytes() []byte {
+	return append([]byte(nil), probes...)
+}
@@ -0,0 +1,25 @@
+package defaultdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	db, err := Default()
+	assert.Nil(t, err)
+	assert.NotNil(t, db.Probe("TCP", "NULL"))
+	assert.Equal(t, FileName, db.Probe("TCP", "NULL").Source)
+
+	again, err := Default()
+	assert.Nil(t, err)
+	assert.Same(t, db, again)
+}
+
+func TestSHA256(t *testing.T) {
+	sum := sha256.Sum256(Bytes())
+	assert.Equal(t, SHA256, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,10 @@
+package defaultdb
+
+// Revision the commit of https://github.com/nmap/nmap the embedded file was
+// taken from, "unknown" for the copy bundled before update.go existed. That
+// copy predates revision tracking and its $Id$ line is unexpanded, so this file
+// is written by hand until `go generate` replaces both.
+const Revision = "unknown"
+
+// SHA256 the hex encoded SHA-256 of the embedded file
+const SHA256 = "4ca666674246ee3737c6dee767eaddc4b1be9ff2edd1a42da53431a47e9716d5"
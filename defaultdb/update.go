@@ -0,0 +1,87 @@
+//go:build ignore
+
+// update replaces the embedded probe file with the one of an nmap commit and
+// records its revision: go run update.go [-rev commit]
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+)
+
+const revisionFile = `// Code generated by update.go; DO NOT EDIT.
+
+package defaultdb
+
+// Revision the commit of https://github.com/nmap/nmap the embedded file was
+// taken from, "unknown" for the copy bundled before update.go existed
+const Revision = %q
+
+// SHA256 the hex encoded SHA-256 of the embedded file
+const SHA256 = %q
+`
+
+func main() {
+	rev := flag.String("rev", "", "nmap commit to take the probe file from, the latest by default")
+	flag.Parse()
+
+	if *rev == "" {
+		var err error
+		if *rev, err = latestCommit(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	probes, err := get("https://raw.githubusercontent.com/nmap/nmap/" + *rev + "/nmap-service-probes")
+	if err != nil {
+		log.Fatal(err)
+	}
+	sum := sha256.Sum256(probes)
+
+	if err = os.WriteFile("nmap-service-probes", probes, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err = os.WriteFile("revision.go", []byte(fmt.Sprintf(revisionFile, *rev, hex.EncodeToString(sum[:]))), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// latestCommit returns the last commit changing the probe file
+func latestCommit() (string, error) {
+	body, err := get("https://api.github.com/repos/nmap/nmap/commits?path=nmap-service-probes&per_page=1")
+	if err != nil {
+		return "", err
+	}
+
+	var commits []struct {
+		SHA string `json:"sha"`
+	}
+	if err = json.Unmarshal(body, &commits); err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("no commit changes nmap-service-probes")
+	}
+
+	return commits[0].SHA, nil
+}
+
+func get(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
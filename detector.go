@@ -0,0 +1,399 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultIntensity nmap's default --version-intensity
+	DefaultIntensity = 7
+	// DefaultConnectTimeout how long connecting to a port may take by default
+	DefaultConnectTimeout = 5 * time.Second
+	// defaultWait how long a probe waits for a response without a totalwaitms directive
+	defaultWait = 5 * time.Second
+	// maxResponseSize the most bytes read in response to a probe
+	maxResponseSize = 64 * 1024
+)
+
+// DetectOptions options of a Detector
+type DetectOptions struct {
+	// Intensity probes with a higher rarity are skipped unless they list the
+	// port, DefaultIntensity when nil. With 0 only the NULL probe and the
+	// probes listing the port are tried, like nmap's --version-intensity 0.
+	Intensity *int
+	// ConnectTimeout DefaultConnectTimeout when zero
+	ConnectTimeout time.Duration
+	// ReadTimeout caps how long each probe waits for a response, otherwise
+	// the totalwaitms directive of the probe or 5 seconds
+	ReadTimeout time.Duration
+	// TLS probes again over TLS when a port is identified as ssl, as nmap does
+	TLS bool
+	// Dial connects to the target, a net.Dialer with ConnectTimeout when nil
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+	// Services names ports no rule identified after their nmap-services
+	// entry, such detections are marked Guessed
+	Services *ServicesTable
+	// RPC names the ONC RPC program of ports identified as rpcbind, see
+	// RPCTable.Identify and RPCTable.Grind
+	RPC *RPCTable
+}
+
+// Target a port to detect the service of
+type Target struct {
+	Protocol string `json:"protocol"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+}
+
+// Address returns host:port
+func (t Target) Address() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// Detection the service detected on a target. Service is empty when no rule
+// matched, Banner then holds the first response received. With the Services
+// option such ports are named after nmap-services and Guessed. Ports of the
+// Exclude directive are Excluded and never connected to.
+type Detection struct {
+	Target
+	Service     string   `json:"service,omitempty"`
+	Soft        bool     `json:"soft,omitempty"`
+	Guessed     bool     `json:"guessed,omitempty"`
+	Excluded    bool     `json:"excluded,omitempty"`
+	RPC         *RPCInfo `json:"rpc,omitempty"`
+	TLS         bool     `json:"tls,omitempty"`
+	Probe       string   `json:"probe,omitempty"`
+	Match       *Match   `json:"match,omitempty"`
+	VersionInfo *VInfo   `json:"versionInfo,omitempty"`
+	Banner      []byte   `json:"banner,omitempty"`
+}
+
+// Detector detects services by sending the probes of a database and
+// matching the responses, the way nmap's version detection does
+type Detector struct {
+	db        *ProbeDB
+	opts      DetectOptions
+	intensity int
+}
+
+// NewDetector creates a detector over a probe database
+func NewDetector(db *ProbeDB, opts DetectOptions) *Detector {
+	if opts.ConnectTimeout == 0 {
+		opts.ConnectTimeout = DefaultConnectTimeout
+	}
+	if opts.Dial == nil {
+		dialer := &net.Dialer{Timeout: opts.ConnectTimeout}
+		opts.Dial = dialer.DialContext
+	}
+
+	intensity := DefaultIntensity
+	if opts.Intensity != nil {
+		intensity = *opts.Intensity
+	}
+
+	return &Detector{db: db, opts: opts, intensity: intensity}
+}
+
+// Payload returns the bytes a probe sends to host, nil for the NULL probe
+// and probes marked no-payload
+func (x *Probe) Payload(host string) ([]byte, error) {
+	if x.NoPayload {
+		return nil, nil
+	}
+
+	return DecodeEscapes(strings.ReplaceAll(x.ProbeString, "{$host}", host))
+}
+
+// Probes returns the probes tried on a port in order: the NULL probe for TCP,
+// the probes listing the port, then the other probes up to the intensity
+func (d *Detector) Probes(protocol string, port int) []*Probe {
+	forPort := d.db.ProbesForPort(protocol, port)
+	isListed := make(map[*Probe]bool, len(forPort))
+	for _, p := range forPort {
+		isListed[p] = true
+	}
+
+	var listed, others []*Probe
+	if null := d.db.Probe(protocol, "NULL"); null != nil {
+		listed = append(listed, null)
+		isListed[null] = true
+	}
+	for _, p := range forPort {
+		if p.ProbeName != "NULL" {
+			listed = append(listed, p)
+		}
+	}
+	for _, p := range d.db.ProbesByProtocol(protocol) {
+		if !isListed[p] && probeRarity(p) <= d.intensity {
+			others = append(others, p)
+		}
+	}
+
+	return append(listed, others...)
+}
+
+// probeRarity returns the rarity of a probe, 1 without a rarity directive
+func probeRarity(p *Probe) int {
+	if rarity, err := strconv.Atoi(p.Rarity); err == nil {
+		return rarity
+	}
+
+	return 1
+}
+
+// Detect detects the service on a target. It fails when no probe got a
+// response because the port cannot be connected to, a port answering no probe
+// is returned without a service. Probing stops at the first failing probe
+// after a response, the detection then holds what was found before.
+func (d *Detector) Detect(ctx context.Context, target Target) (*Detection, error) {
+	if d.db.IsExcluded(target.Protocol, target.Port) {
+		return &Detection{Target: target, Excluded: true}, nil
+	}
+
+	detection, err := d.detect(ctx, target, false)
+	if err != nil {
+		return nil, err
+	}
+	if detection.Service == "" {
+		d.guessService(detection)
+	}
+	if detection.Service == "rpcbind" {
+		d.identifyRPC(ctx, detection)
+	}
+	if !d.opts.TLS || detection.Service != "ssl" {
+		return detection, nil
+	}
+
+	// identify the service tunneled in TLS, ssl/<service> as nmap names it,
+	// a failed handshake or tcpwrapped tunnel keeps the plain detection
+	tunneled, err := d.detect(ctx, target, true)
+	if err != nil || tunneled.Service == "" || tunneled.Service == "tcpwrapped" {
+		return detection, nil
+	}
+	tunneled.TLS = true
+
+	return tunneled, nil
+}
+
+func (d *Detector) detect(ctx context.Context, target Target, useTLS bool) (*Detection, error) {
+	detection := &Detection{Target: target}
+	var soft *MatchResult
+	for _, p := range d.Probes(target.Protocol, target.Port) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if soft != nil && !probeHasService(d.db, p, soft.Service) {
+			continue
+		}
+
+		response, closed, err := d.exchange(ctx, target, p, useTLS)
+		if err != nil && detection.Banner == nil {
+			return nil, err
+		}
+		if err != nil {
+			break
+		}
+		if detection.Banner == nil && len(response) > 0 {
+			detection.Banner = response
+		}
+		if p.ProbeName == "NULL" && closed && len(response) == 0 && p.TcpWrappedMs != "" {
+			detection.Service = "tcpwrapped"
+			return detection, nil
+		}
+		if len(response) == 0 {
+			continue
+		}
+
+		result := d.db.MatchResponse(p, response)
+		if result == nil || soft != nil && result.Service != soft.Service {
+			continue
+		}
+		if !result.Soft {
+			return fillDetection(detection, result, response, useTLS), nil
+		}
+		if soft == nil {
+			soft = result
+			fillDetection(detection, result, response, useTLS)
+		}
+	}
+
+	return detection, nil
+}
+
+// guessService names a port no rule identified after its nmap-services entry
+func (d *Detector) guessService(detection *Detection) {
+	if d.opts.Services == nil {
+		return
+	}
+	if entry := d.opts.Services.Lookup(detection.Protocol, detection.Port); entry != nil && entry.Name != "unknown" {
+		detection.Service = entry.Name
+		detection.Guessed = true
+	}
+}
+
+// identifyRPC decodes the program and versions of an rpcbind detection from
+// the call of its probe and the response. A port refusing the program called
+// speaks RPC for another one, found by grinding and named after it like nmap
+// does.
+func (d *Detector) identifyRPC(ctx context.Context, detection *Detection) {
+	p := d.db.Probe(detection.Protocol, detection.Probe)
+	if d.opts.RPC == nil || p == nil {
+		return
+	}
+	call, err := p.Payload(detection.Host)
+	if err != nil {
+		return
+	}
+	if detection.RPC = d.opts.RPC.Identify(detection.Protocol, call, detection.Banner); detection.RPC != nil {
+		return
+	}
+	if !rpcProgramUnavailable(detection.Protocol, call, detection.Banner) {
+		return
+	}
+	if detection.RPC = d.grindRPC(ctx, detection.Target, p); detection.RPC != nil && detection.RPC.Name != "" {
+		detection.Service = detection.RPC.Name
+	}
+}
+
+// grindRPC runs RPC grinding on a new connection to the target, each call
+// waiting as long as the probe that found the port
+func (d *Detector) grindRPC(ctx context.Context, target Target, p *Probe) *RPCInfo {
+	connectCtx, cancel := context.WithTimeout(ctx, d.opts.ConnectTimeout)
+	defer cancel()
+	conn, err := d.opts.Dial(connectCtx, strings.ToLower(target.Protocol), target.Address())
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	tcp := strings.EqualFold(target.Protocol, "TCP")
+	buf := make([]byte, maxRPCRecord)
+
+	return d.opts.RPC.Grind(target.Protocol, func(call []byte) ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := conn.SetDeadline(time.Now().Add(d.wait(p))); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(call); err != nil {
+			return nil, err
+		}
+		if tcp {
+			return readRPCRecord(conn)
+		}
+		n, err := conn.Read(buf)
+		return buf[:n], err
+	})
+}
+
+// probeHasService reports whether p or its fallbacks have rules for the service
+func probeHasService(db *ProbeDB, p *Probe, service string) bool {
+	for _, probe := range db.FallbackChain(p) {
+		for _, m := range probe.Matches {
+			if m.Name == service {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func fillDetection(detection *Detection, result *MatchResult, response []byte, useTLS bool) *Detection {
+	detection.Service = result.Service
+	if useTLS && !strings.HasPrefix(result.Service, "ssl") {
+		detection.Service = "ssl/" + result.Service
+	}
+	detection.Soft = result.Soft
+	detection.Probe = result.Probe.ProbeName
+	detection.Match = result.Match
+	detection.VersionInfo = result.VersionInfo
+	detection.Banner = response
+
+	return detection
+}
+
+// exchange sends the payload of a probe on a new connection and reads the
+// response until it matches, the connection is closed or the wait is over.
+// closed reports whether the peer closed the connection within tcpwrappedms.
+func (d *Detector) exchange(ctx context.Context, target Target, p *Probe, useTLS bool) (response []byte, closed bool, err error) {
+	payload, err := p.Payload(target.Host)
+	if err != nil {
+		return nil, false, err
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, d.opts.ConnectTimeout)
+	defer cancel()
+	conn, err := d.opts.Dial(connectCtx, strings.ToLower(target.Protocol), target.Address())
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+
+	if useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: target.Host})
+		if err = tlsConn.HandshakeContext(connectCtx); err != nil {
+			return nil, false, err
+		}
+		conn = tlsConn
+	}
+
+	start := time.Now()
+	if err = conn.SetDeadline(start.Add(d.wait(p))); err != nil {
+		return nil, false, err
+	}
+	if len(payload) > 0 {
+		if _, err = conn.Write(payload); err != nil {
+			return nil, true, nil
+		}
+	}
+
+	var buf bytes.Buffer
+	chunk := make([]byte, 4096)
+	for buf.Len() < maxResponseSize {
+		n, readErr := conn.Read(chunk)
+		buf.Write(chunk[:n])
+		if n > 0 {
+			if result := d.db.MatchResponse(p, buf.Bytes()); result != nil && !result.Soft {
+				break
+			}
+		}
+		if readErr != nil {
+			if !errors.Is(readErr, os.ErrDeadlineExceeded) {
+				closed = time.Since(start) < probeTcpWrapped(p)
+			}
+			break
+		}
+	}
+
+	return buf.Bytes(), closed, nil
+}
+
+// wait returns how long to wait for the response to a probe
+func (d *Detector) wait(p *Probe) time.Duration {
+	wait := defaultWait
+	if ms, err := strconv.Atoi(p.TotalWaitMs); err == nil {
+		wait = time.Duration(ms) * time.Millisecond
+	}
+	if d.opts.ReadTimeout > 0 && d.opts.ReadTimeout < wait {
+		wait = d.opts.ReadTimeout
+	}
+
+	return wait
+}
+
+// probeTcpWrapped returns the tcpwrappedms directive of a probe
+func probeTcpWrapped(p *Probe) time.Duration {
+	ms, _ := strconv.Atoi(p.TcpWrappedMs)
+	return time.Duration(ms) * time.Millisecond
+}
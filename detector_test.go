@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serve accepts connections on a local port and answers them with handle
+func serve(t *testing.T, handle func(conn net.Conn)) Target {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return Target{Protocol: "TCP", Host: "127.0.0.1", Port: addr.Port}
+}
+
+func TestDetector(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+	detector := NewDetector(db, DetectOptions{ReadTimeout: 300 * time.Millisecond})
+
+	// a banner sent on connect is matched by the NULL probe
+	ssh := serve(t, func(conn net.Conn) {
+		conn.Write([]byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1\r\n"))
+		time.Sleep(time.Second)
+	})
+	detection, err := detector.Detect(context.Background(), ssh)
+	assert.Nil(t, err)
+	assert.Equal(t, "ssh", detection.Service)
+	assert.Equal(t, "NULL", detection.Probe)
+	assert.Equal(t, "8.9p1 Ubuntu 3ubuntu0.1", detection.VersionInfo.Version)
+
+	// a server waiting for a request is identified by a later probe
+	web := serve(t, func(conn net.Conn) {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err == nil && strings.HasPrefix(line, "GET ") {
+			conn.Write([]byte("HTTP/1.1 200 OK\r\nServer: nginx/1.18.0\r\nContent-Length: 0\r\n\r\n"))
+		}
+	})
+	detection, err = detector.Detect(context.Background(), web)
+	assert.Nil(t, err)
+	assert.Equal(t, "http", detection.Service)
+	assert.Equal(t, "GetRequest", detection.Probe)
+	assert.Equal(t, "1.18.0", detection.VersionInfo.Version)
+
+	// closing the connection at once is tcpwrapped
+	wrapped := serve(t, func(conn net.Conn) {})
+	detection, err = detector.Detect(context.Background(), wrapped)
+	assert.Nil(t, err)
+	assert.Equal(t, "tcpwrapped", detection.Service)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed := Target{Protocol: "TCP", Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}
+	ln.Close()
+	_, err = detector.Detect(context.Background(), closed)
+	assert.NotNil(t, err)
+}
+
+func TestDetectorProbes(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+
+	intensity := 1
+	probes := NewDetector(db, DetectOptions{Intensity: &intensity}).Probes("TCP", 80)
+	assert.Equal(t, "NULL", probes[0].ProbeName)
+	assert.Contains(t, probes, db.Probe("TCP", "HTTPOptions"))
+	for _, p := range probes[1:] {
+		assert.True(t, db.probeHasPort(p, 80) || probeRarity(p) <= 1, p.ProbeName)
+	}
+
+	// intensity 0 tries the NULL probe and the probes listing the port only
+	intensity = 0
+	probes = NewDetector(db, DetectOptions{Intensity: &intensity}).Probes("TCP", 80)
+	assert.Equal(t, "NULL", probes[0].ProbeName)
+	assert.Contains(t, probes, db.Probe("TCP", "GetRequest"))
+	for _, p := range probes[1:] {
+		assert.True(t, db.probeHasPort(p, 80), p.ProbeName)
+	}
+	assert.Greater(t, len(NewDetector(db, DetectOptions{}).Probes("TCP", 80)), len(probes))
+
+	payload, err := db.Probe("TCP", "GetRequest").Payload("example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "GET / HTTP/1.0\r\n\r\n", string(payload))
+}
+
+func TestDetectorTLSHandshakeFailure(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+	detector := NewDetector(db, DetectOptions{ReadTimeout: 300 * time.Millisecond, TLS: true})
+
+	// a server rejecting every ClientHello with a handshake_failure alert,
+	// like TLS 1.0-only servers do with Go's defaults, stays plain ssl
+	target := serve(t, func(conn net.Conn) {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		head := make([]byte, 1)
+		if _, err := conn.Read(head); err == nil && head[0] == 0x16 {
+			conn.Write([]byte("\x15\x03\x01\x00\x02\x02\x28"))
+		}
+	})
+	detection, err := detector.Detect(context.Background(), target)
+	assert.Nil(t, err)
+	assert.Equal(t, "ssl", detection.Service)
+	assert.False(t, detection.TLS)
+}
+
+func TestDetectorExcluded(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+
+	// no connection is attempted to a port of the Exclude directive
+	dialed := false
+	detector := NewDetector(db, DetectOptions{Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = true
+		return nil, net.ErrClosed
+	}})
+	detection, err := detector.Detect(context.Background(), Target{Protocol: "TCP", Host: "127.0.0.1", Port: 9100})
+	assert.Nil(t, err)
+	assert.False(t, dialed)
+	assert.Equal(t, "", detection.Service)
+	assert.True(t, detection.Excluded)
+}
+
+func TestDetectorKeepsResponseAfterFailure(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+	detector := NewDetector(db, DetectOptions{ReadTimeout: 300 * time.Millisecond})
+
+	// the port answers the NULL probe, then refuses the connections of later probes
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		conn, err := ln.Accept()
+		ln.Close()
+		if err == nil {
+			conn.Write([]byte("hello\r\n"))
+			conn.Close()
+		}
+	}()
+	target := Target{Protocol: "TCP", Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}
+
+	detection, err := detector.Detect(context.Background(), target)
+	assert.Nil(t, err)
+	assert.Equal(t, "", detection.Service)
+	assert.Equal(t, "hello\r\n", string(detection.Banner))
+}
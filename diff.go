@@ -0,0 +1,265 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DiffKind how an element differs between two databases
+type DiffKind string
+
+const (
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+)
+
+// FieldChange a field whose value differs between the old and the new element
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// MatchDiff a match rule added, removed or changed within a probe. Rules are
+// identified by service name and pattern.
+type MatchDiff struct {
+	Kind    DiffKind       `json:"kind"`
+	Service string         `json:"service"`
+	Pattern string         `json:"pattern"`
+	OldLine int            `json:"oldLine,omitempty"`
+	NewLine int            `json:"newLine,omitempty"`
+	Changes []*FieldChange `json:"changes,omitempty"`
+}
+
+// ProbeDiff a probe added, removed or changed, along with its match rule differences
+type ProbeDiff struct {
+	Kind      DiffKind       `json:"kind"`
+	Protocol  string         `json:"protocol"`
+	ProbeName string         `json:"probeName"`
+	Changes   []*FieldChange `json:"changes,omitempty"`
+	Matches   []*MatchDiff   `json:"matches,omitempty"`
+}
+
+// DiffSummary counts the differences by kind
+type DiffSummary struct {
+	ProbesAdded    int `json:"probesAdded"`
+	ProbesRemoved  int `json:"probesRemoved"`
+	ProbesChanged  int `json:"probesChanged"`
+	MatchesAdded   int `json:"matchesAdded"`
+	MatchesRemoved int `json:"matchesRemoved"`
+	MatchesChanged int `json:"matchesChanged"`
+}
+
+// ProbeDBDiff the semantic differences between two probe databases
+type ProbeDBDiff struct {
+	Summary DiffSummary    `json:"summary"`
+	Exclude []*FieldChange `json:"exclude,omitempty"`
+	Probes  []*ProbeDiff   `json:"probes"`
+}
+
+// IsEmpty reports whether both databases are equivalent
+func (d *ProbeDBDiff) IsEmpty() bool {
+	return len(d.Exclude) == 0 && len(d.Probes) == 0
+}
+
+// DiffProbeDBs compares two databases probe by probe (keyed by protocol and
+// name) and rule by rule (keyed by service and pattern). Reordering alone is
+// not reported.
+func DiffProbeDBs(oldDB, newDB *ProbeDB) *ProbeDBDiff {
+	d := &ProbeDBDiff{Probes: make([]*ProbeDiff, 0)}
+	if change := diffField("exclude", strings.Join(oldDB.Exclude, ","), strings.Join(newDB.Exclude, ",")); change != nil {
+		d.Exclude = append(d.Exclude, change)
+	}
+
+	for _, oldProbe := range oldDB.Probes {
+		newProbe := newDB.Probe(oldProbe.Protocol, oldProbe.ProbeName)
+		if newProbe == nil {
+			d.addProbeDiff(newProbeDiff(DiffRemoved, oldProbe, nil))
+			continue
+		}
+		if pd := newProbeDiff(DiffChanged, oldProbe, newProbe); len(pd.Changes) > 0 || len(pd.Matches) > 0 {
+			d.addProbeDiff(pd)
+		}
+	}
+
+	for _, newProbe := range newDB.Probes {
+		if oldDB.Probe(newProbe.Protocol, newProbe.ProbeName) == nil {
+			d.addProbeDiff(newProbeDiff(DiffAdded, nil, newProbe))
+		}
+	}
+
+	return d
+}
+
+func (d *ProbeDBDiff) addProbeDiff(pd *ProbeDiff) {
+	d.Probes = append(d.Probes, pd)
+	switch pd.Kind {
+	case DiffAdded:
+		d.Summary.ProbesAdded++
+	case DiffRemoved:
+		d.Summary.ProbesRemoved++
+	default:
+		d.Summary.ProbesChanged++
+	}
+
+	for _, md := range pd.Matches {
+		switch md.Kind {
+		case DiffAdded:
+			d.Summary.MatchesAdded++
+		case DiffRemoved:
+			d.Summary.MatchesRemoved++
+		default:
+			d.Summary.MatchesChanged++
+		}
+	}
+}
+
+func diffField(field, oldValue, newValue string) *FieldChange {
+	if oldValue == newValue {
+		return nil
+	}
+
+	return &FieldChange{Field: field, Old: oldValue, New: newValue}
+}
+
+// probeFields the comparable directives of a probe
+func probeFields(p *Probe) [][2]string {
+	if p == nil {
+		p = &Probe{}
+	}
+
+	return [][2]string{
+		{"probeString", p.ProbeString},
+		{"ports", strings.Join(p.Ports, ",")},
+		{"sslports", strings.Join(p.SslPorts, ",")},
+		{"rarity", p.Rarity},
+		{"totalwaitms", p.TotalWaitMs},
+		{"tcpwrappedms", p.TcpWrappedMs},
+		{"fallback", p.Fallback},
+		{"noPayload", strconv.FormatBool(p.NoPayload)},
+	}
+}
+
+// matchFields the comparable parts of a match rule besides its key
+func matchFields(m *Match) [][2]string {
+	vInfo := m.VersionInfo
+	if vInfo == nil {
+		vInfo = &VInfo{}
+	}
+
+	cpes := formatCPEURIs(vInfo)
+
+	return [][2]string{
+		{"soft", strconv.FormatBool(m.Soft)},
+		{"patternFlag", m.PatternFlag},
+		{"vendorProductName", vInfo.VendorProductName},
+		{"version", vInfo.Version},
+		{"info", vInfo.Info},
+		{"hostname", vInfo.Hostname},
+		{"operatingSystem", vInfo.OperatingSystem},
+		{"deviceType", vInfo.DeviceType},
+		{"cpe", strings.Join(cpes, " ")},
+	}
+}
+
+func diffFields(oldFields, newFields [][2]string) (changes []*FieldChange) {
+	for i := range oldFields {
+		if change := diffField(oldFields[i][0], oldFields[i][1], newFields[i][1]); change != nil {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// matchKeys keys every rule by service and pattern, numbering repeated keys
+func matchKeys(p *Probe) (keys []string, byKey map[string]*Match) {
+	byKey = make(map[string]*Match)
+	if p == nil {
+		return nil, byKey
+	}
+
+	seen := make(map[string]int)
+	for _, m := range p.Matches {
+		key := m.Name + " " + m.Pattern
+		seen[key]++
+		if seen[key] > 1 {
+			key += "#" + strconv.Itoa(seen[key])
+		}
+		keys = append(keys, key)
+		byKey[key] = m
+	}
+
+	return keys, byKey
+}
+
+func newProbeDiff(kind DiffKind, oldProbe, newProbe *Probe) *ProbeDiff {
+	ref := newProbe
+	if ref == nil {
+		ref = oldProbe
+	}
+	pd := &ProbeDiff{Kind: kind, Protocol: ref.Protocol, ProbeName: ref.ProbeName}
+	if kind == DiffChanged {
+		pd.Changes = diffFields(probeFields(oldProbe), probeFields(newProbe))
+	}
+
+	oldKeys, oldMatches := matchKeys(oldProbe)
+	newKeys, newMatches := matchKeys(newProbe)
+	for _, key := range oldKeys {
+		oldMatch := oldMatches[key]
+		newMatch, ok := newMatches[key]
+		if !ok {
+			pd.Matches = append(pd.Matches, &MatchDiff{Kind: DiffRemoved, Service: oldMatch.Name, Pattern: oldMatch.Pattern, OldLine: oldMatch.Line})
+			continue
+		}
+		if changes := diffFields(matchFields(oldMatch), matchFields(newMatch)); len(changes) > 0 {
+			pd.Matches = append(pd.Matches, &MatchDiff{Kind: DiffChanged, Service: newMatch.Name, Pattern: newMatch.Pattern,
+				OldLine: oldMatch.Line, NewLine: newMatch.Line, Changes: changes})
+		}
+	}
+	for _, key := range newKeys {
+		if _, ok := oldMatches[key]; !ok {
+			newMatch := newMatches[key]
+			pd.Matches = append(pd.Matches, &MatchDiff{Kind: DiffAdded, Service: newMatch.Name, Pattern: newMatch.Pattern, NewLine: newMatch.Line})
+		}
+	}
+
+	return pd
+}
+
+var diffKindMarks = map[DiffKind]string{DiffAdded: "+", DiffRemoved: "-", DiffChanged: "~"}
+
+// WriteText writes the differences in a human readable form
+func (d *ProbeDBDiff) WriteText(w io.Writer) error {
+	var sb strings.Builder
+	s := d.Summary
+	fmt.Fprintf(&sb, "probes: %d added, %d removed, %d changed; matches: %d added, %d removed, %d changed\n",
+		s.ProbesAdded, s.ProbesRemoved, s.ProbesChanged, s.MatchesAdded, s.MatchesRemoved, s.MatchesChanged)
+
+	for _, change := range d.Exclude {
+		fmt.Fprintf(&sb, "~ %s: %q -> %q\n", change.Field, change.Old, change.New)
+	}
+
+	for _, pd := range d.Probes {
+		fmt.Fprintf(&sb, "\n%s Probe %s %s\n", diffKindMarks[pd.Kind], pd.Protocol, pd.ProbeName)
+		for _, change := range pd.Changes {
+			fmt.Fprintf(&sb, "    %s: %q -> %q\n", change.Field, change.Old, change.New)
+		}
+		for _, md := range pd.Matches {
+			line := md.NewLine
+			if line == 0 {
+				line = md.OldLine
+			}
+			fmt.Fprintf(&sb, "  %s %s m|%s| (line %d)\n", diffKindMarks[md.Kind], md.Service, md.Pattern, line)
+			for _, change := range md.Changes {
+				fmt.Fprintf(&sb, "      %s: %q -> %q\n", change.Field, change.Old, change.New)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffProbeDBs(t *testing.T) {
+	oldSrc := `Exclude T:9100-9107
+
+Probe TCP NULL q||
+totalwaitms 6000
+match ftp m|^220 FTP\r\n| p/generic ftpd/
+match ssh m|^SSH-([\d.]+)-| p/generic sshd/ v/$1/
+match telnet m|^\xff\xfb| p/telnetd/
+
+Probe UDP Help q|help\r\n|
+rarity 3
+`
+	newSrc := `Exclude T:9100-9107
+
+Probe TCP NULL q||
+totalwaitms 5000
+match ftp m|^220 FTP\r\n| p/generic ftpd/
+match ssh m|^SSH-([\d.]+)-| p/OpenSSH/ v/$1/ cpe:/a:openbsd:openssh:$1/
+match redis m|^-ERR| p/Redis key-value store/
+
+Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+ports 80
+match http m|^HTTP/1\.[01] \d\d\d|
+`
+	oldDB, err := client.ParseProbeDBReader(strings.NewReader(oldSrc), "old")
+	assert.Nil(t, err)
+	newDB, err := client.ParseProbeDBReader(strings.NewReader(newSrc), "new")
+	assert.Nil(t, err)
+
+	d := DiffProbeDBs(oldDB, newDB)
+	assert.Equal(t, DiffSummary{ProbesAdded: 1, ProbesRemoved: 1, ProbesChanged: 1, MatchesAdded: 2, MatchesRemoved: 1, MatchesChanged: 1}, d.Summary)
+
+	null := d.Probes[0]
+	assert.Equal(t, DiffChanged, null.Kind)
+	assert.Equal(t, []*FieldChange{{Field: "totalwaitms", Old: "6000", New: "5000"}}, null.Changes)
+
+	ssh := null.Matches[0]
+	assert.Equal(t, DiffChanged, ssh.Kind)
+	assert.Equal(t, "ssh", ssh.Service)
+	assert.Equal(t, []*FieldChange{
+		{Field: "vendorProductName", Old: "generic sshd", New: "OpenSSH"},
+		{Field: "cpe", Old: "", New: "cpe:/a:openbsd:openssh:$1"},
+	}, ssh.Changes)
+
+	assert.Equal(t, DiffRemoved, null.Matches[1].Kind)
+	assert.Equal(t, "telnet", null.Matches[1].Service)
+	assert.Equal(t, DiffAdded, null.Matches[2].Kind)
+	assert.Equal(t, "redis", null.Matches[2].Service)
+
+	assert.Equal(t, DiffRemoved, d.Probes[1].Kind)
+	assert.Equal(t, "Help", d.Probes[1].ProbeName)
+	assert.Equal(t, DiffAdded, d.Probes[2].Kind)
+	assert.Equal(t, "GetRequest", d.Probes[2].ProbeName)
+
+	var sb strings.Builder
+	assert.Nil(t, d.WriteText(&sb))
+	assert.Contains(t, sb.String(), "~ Probe TCP NULL")
+	assert.Contains(t, sb.String(), `vendorProductName: "generic sshd" -> "OpenSSH"`)
+
+	assert.True(t, DiffProbeDBs(oldDB, oldDB).IsEmpty())
+}
@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"github.com/pkg/errors"
+)
+
+var ErrEscape = errors.New("invalid escape sequence")
+
+// DecodeEscapes decodes the C style escapes of nmap probe strings and payloads:
+// \0, \a, \b, \f, \n, \r, \t, \v, \\ and \xHH. Any other escaped character
+// stands for itself, as with `\|` in a probe string delimited by `|`.
+func DecodeEscapes(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return nil, errors.WithMessage(ErrEscape, "trailing backslash")
+		}
+		switch s[i] {
+		case '0':
+			b = append(b, 0)
+		case 'a':
+			b = append(b, '\a')
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'v':
+			b = append(b, '\v')
+		case 'x':
+			if i+2 >= len(s) || !isHexDigit(s[i+1]) || !isHexDigit(s[i+2]) {
+				return nil, errors.WithMessagef(ErrEscape, "\\x at offset %d", i-1)
+			}
+			b = append(b, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+		default:
+			b = append(b, s[i])
+		}
+	}
+
+	return b, nil
+}
@@ -0,0 +1,276 @@
+package parser
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//go:generate go run ./cmd/nmap-parser schema -o nmap-service-probes.schema.json
+
+// JSONSchemaVersion the version of the JSON document format, increased on incompatible changes
+const JSONSchemaVersion = 1
+
+var ErrJSONFormat = errors.New("invalid probe JSON document")
+
+// JSONDocument the versioned JSON form of a probe database written by
+// WriteJSON and read by LoadJSON
+type JSONDocument struct {
+	SchemaVersion int          `json:"schemaVersion" desc:"version of the document format, currently 1"`
+	Exclude       []string     `json:"exclude,omitempty" desc:"ports of the Exclude directive, such as T:9100-9107"`
+	Probes        []*JSONProbe `json:"probes" desc:"probes in the order nmap tries them"`
+}
+
+// JSONProbe a probe of a JSONDocument
+type JSONProbe struct {
+	Protocol     string       `json:"protocol" desc:"TCP or UDP"`
+	ProbeName    string       `json:"probeName"`
+	ProbeString  string       `json:"probeString" desc:"payload with nmap's C style escapes, {$host} is replaced by the target"`
+	NoPayload    bool         `json:"noPayload,omitempty" desc:"the probe string is not sent"`
+	Ports        []string     `json:"ports,omitempty" desc:"ports and port ranges the probe is most likely to identify"`
+	SslPorts     []string     `json:"sslPorts,omitempty" desc:"the same for ports wrapped in SSL/TLS"`
+	Rarity       int          `json:"rarity,omitempty" desc:"1 to 9, probes rarer than the intensity are skipped"`
+	TotalWaitMs  int          `json:"totalWaitMs,omitempty" desc:"how long to wait for a response"`
+	TcpWrappedMs int          `json:"tcpWrappedMs,omitempty" desc:"a connection closed before is tcpwrapped"`
+	Fallback     []string     `json:"fallback,omitempty" desc:"probes whose rules are also tried on the response"`
+	Matches      []*JSONMatch `json:"matches"`
+	Source       string       `json:"source,omitempty" desc:"file the probe was parsed from"`
+	Line         int          `json:"line,omitempty" desc:"line of the Probe directive"`
+	Comment      string       `json:"comment,omitempty" desc:"comment block preceding the probe and its directives"`
+
+	DirectiveLines map[string]int `json:"directiveLines,omitempty" desc:"line of each directive, such as ports or rarity"`
+}
+
+// JSONMatch a match rule of a JSONProbe
+type JSONMatch struct {
+	Service     string           `json:"service"`
+	Soft        bool             `json:"soft,omitempty" desc:"softmatch rule"`
+	Pattern     string           `json:"pattern" desc:"PCRE pattern matched against the raw response bytes"`
+	PatternFlag string           `json:"patternFlag,omitempty" desc:"i for case-insensitive, s for dot matching newlines"`
+	VersionInfo *JSONVersionInfo `json:"versionInfo,omitempty"`
+	Source      string           `json:"source,omitempty"`
+	Line        int              `json:"line,omitempty"`
+	Comment     string           `json:"comment,omitempty"`
+}
+
+// JSONVersionInfo the version info templates of a JSONMatch, `$1` and the
+// helpers `$P()`, `$SUBST()` and `$I()` are filled from the captures
+type JSONVersionInfo struct {
+	Product         string     `json:"product,omitempty" desc:"p/ field"`
+	Version         string     `json:"version,omitempty" desc:"v/ field"`
+	Info            string     `json:"info,omitempty" desc:"i/ field"`
+	Hostname        string     `json:"hostname,omitempty" desc:"h/ field"`
+	OperatingSystem string     `json:"operatingSystem,omitempty" desc:"o/ field"`
+	DeviceType      string     `json:"deviceType,omitempty" desc:"d/ field"`
+	Cpe             []*JSONCPE `json:"cpe,omitempty"`
+}
+
+// JSONCPE a CPE template of a JSONVersionInfo
+type JSONCPE struct {
+	URI   string `json:"uri" desc:"CPE 2.2 URI template, such as cpe:/a:igor_sysoev:nginx:$1"`
+	Flags string `json:"flags,omitempty" desc:"option letters following the CPE, a for applications"`
+}
+
+// NewJSONDocument converts a probe database to its JSON form. It fails on
+// numeric directives that are not numbers.
+func NewJSONDocument(db *ProbeDB) (*JSONDocument, error) {
+	doc := &JSONDocument{SchemaVersion: JSONSchemaVersion, Exclude: db.Exclude, Probes: make([]*JSONProbe, 0, len(db.Probes))}
+	for _, p := range db.Probes {
+		jp := &JSONProbe{
+			Protocol:    p.Protocol,
+			ProbeName:   p.ProbeName,
+			ProbeString: p.ProbeString,
+			NoPayload:   p.NoPayload,
+			Ports:       p.Ports,
+			SslPorts:    p.SslPorts,
+			Matches:     make([]*JSONMatch, 0, len(p.Matches)),
+			Source:      p.Source,
+			Line:        p.Line,
+			Comment:     p.Comment,
+
+			DirectiveLines: p.DirectiveLines,
+		}
+		numbers := []struct {
+			name  string
+			value string
+			dst   *int
+		}{{"rarity", p.Rarity, &jp.Rarity}, {"totalwaitms", p.TotalWaitMs, &jp.TotalWaitMs}, {"tcpwrappedms", p.TcpWrappedMs, &jp.TcpWrappedMs}}
+		for _, n := range numbers {
+			if n.value == "" {
+				continue
+			}
+			var err error
+			if *n.dst, err = strconv.Atoi(n.value); err != nil {
+				return nil, errors.WithMessagef(ErrJSONFormat, "probe %s %s: %s %q", p.Protocol, p.ProbeName, n.name, n.value)
+			}
+		}
+		if p.Fallback != "" {
+			jp.Fallback = strings.Split(p.Fallback, ",")
+		}
+
+		for _, m := range p.Matches {
+			jp.Matches = append(jp.Matches, newJSONMatch(m))
+		}
+		doc.Probes = append(doc.Probes, jp)
+	}
+
+	return doc, nil
+}
+
+func newJSONMatch(m *Match) *JSONMatch {
+	jm := &JSONMatch{Service: m.Name, Soft: m.Soft, Pattern: m.Pattern, PatternFlag: m.PatternFlag,
+		Source: m.Source, Line: m.Line, Comment: m.Comment}
+	v := m.VersionInfo
+	if v == nil || v.IsEmpty() {
+		return jm
+	}
+
+	jm.VersionInfo = &JSONVersionInfo{Product: v.VendorProductName, Version: v.Version, Info: v.Info,
+		Hostname: v.Hostname, OperatingSystem: v.OperatingSystem, DeviceType: v.DeviceType}
+	for i, c := range v.Cpe {
+		jc := &JSONCPE{URI: "cpe:/" + formatCPETemplate(c)}
+		if i < len(v.CpeFlags) {
+			jc.Flags = v.CpeFlags[i]
+		}
+		jm.VersionInfo.Cpe = append(jm.VersionInfo.Cpe, jc)
+	}
+
+	return jm
+}
+
+// ProbeDB validates the document and rebuilds the probe database it describes
+func (doc *JSONDocument) ProbeDB() (*ProbeDB, error) {
+	if doc.SchemaVersion != JSONSchemaVersion {
+		return nil, errors.WithMessagef(ErrJSONFormat, "unsupported schema version %d", doc.SchemaVersion)
+	}
+	if _, err := parsePortSpec(doc.Exclude); err != nil {
+		return nil, errors.WithMessagef(ErrJSONFormat, "exclude: %v", err)
+	}
+
+	probes := make([]*Probe, 0, len(doc.Probes))
+	for i, jp := range doc.Probes {
+		if jp == nil || jp.Protocol != "TCP" && jp.Protocol != "UDP" || jp.ProbeName == "" {
+			return nil, errors.WithMessagef(ErrJSONFormat, "probe %d needs a protocol of TCP or UDP and a name", i)
+		}
+		p, err := jp.probe()
+		if err != nil {
+			return nil, errors.WithMessagef(ErrJSONFormat, "probe %s %s: %v", jp.Protocol, jp.ProbeName, err)
+		}
+		probes = append(probes, p)
+	}
+
+	db := NewProbeDB(probes, doc.Exclude...)
+
+	return db, nil
+}
+
+func (jp *JSONProbe) probe() (*Probe, error) {
+	if _, err := DecodeEscapes(jp.ProbeString); err != nil {
+		return nil, err
+	}
+	if _, err := parsePortSpec(append(append([]string{}, jp.Ports...), jp.SslPorts...)); err != nil {
+		return nil, err
+	}
+
+	p := &Probe{
+		Protocol:    jp.Protocol,
+		ProbeName:   jp.ProbeName,
+		ProbeString: jp.ProbeString,
+		NoPayload:   jp.NoPayload,
+		Ports:       jp.Ports,
+		SslPorts:    jp.SslPorts,
+		Fallback:    strings.Join(jp.Fallback, ","),
+		Source:      jp.Source,
+		Line:        jp.Line,
+		Comment:     jp.Comment,
+
+		DirectiveLines: jp.DirectiveLines,
+	}
+	if jp.Rarity != 0 {
+		p.Rarity = strconv.Itoa(jp.Rarity)
+	}
+	if jp.TotalWaitMs != 0 {
+		p.TotalWaitMs = strconv.Itoa(jp.TotalWaitMs)
+	}
+	if jp.TcpWrappedMs != 0 {
+		p.TcpWrappedMs = strconv.Itoa(jp.TcpWrappedMs)
+	}
+
+	for i, jm := range jp.Matches {
+		if jm == nil || jm.Service == "" || jm.Pattern == "" {
+			return nil, errors.Errorf("match %d needs a service and a pattern", i)
+		}
+		m, err := jm.match()
+		if err != nil {
+			return nil, errors.WithMessagef(err, "match %d (%s)", i, jm.Service)
+		}
+		p.Matches = append(p.Matches, m)
+	}
+
+	return p, nil
+}
+
+func (jm *JSONMatch) match() (*Match, error) {
+	m := &Match{Pattern: jm.Pattern, Name: jm.Service, Soft: jm.Soft, PatternFlag: jm.PatternFlag,
+		VersionInfo: &VInfo{}, Source: jm.Source, Line: jm.Line, Comment: jm.Comment}
+	jv := jm.VersionInfo
+	if jv == nil {
+		return m, nil
+	}
+
+	v := m.VersionInfo
+	v.VendorProductName, v.Version, v.Info = jv.Product, jv.Version, jv.Info
+	v.Hostname, v.OperatingSystem, v.DeviceType = jv.Hostname, jv.OperatingSystem, jv.DeviceType
+	for _, jc := range jv.Cpe {
+		if jc == nil || !strings.HasPrefix(jc.URI, "cpe:/") {
+			return nil, errors.New("cpe needs a cpe:/ uri")
+		}
+		c, err := parseCPE22Body(jc.URI[len("cpe:/"):])
+		if err != nil {
+			return nil, err
+		}
+		v.Cpe = append(v.Cpe, c)
+		v.CpeFlags = append(v.CpeFlags, jc.Flags)
+	}
+	if !hasCpeFlags(v.CpeFlags) {
+		v.CpeFlags = nil
+	}
+
+	return m, nil
+}
+
+// WriteJSON writes a probe database as a compact JSONDocument
+func (c *Client) WriteJSON(w io.Writer, db *ProbeDB) error {
+	doc, err := NewJSONDocument(db)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// LoadJSON reads a JSONDocument, validates it and rebuilds the probe database
+// with the pattern of every rule compiled, ready for matching
+func (c *Client) LoadJSON(r io.Reader) (*ProbeDB, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	doc := &JSONDocument{}
+	if err := decoder.Decode(doc); err != nil {
+		return nil, errors.WithMessage(ErrJSONFormat, err.Error())
+	}
+
+	db, err := doc.ProbeDB()
+	if err != nil {
+		return nil, err
+	}
+	db.EachMatch(func(p *Probe, m *Match) bool {
+		// patterns Go cannot compile are cached as such and never match
+		_, _ = db.CompiledPattern(m)
+		return true
+	})
+
+	return db, nil
+}
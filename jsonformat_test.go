@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteLoadJSON(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, client.WriteJSON(&buf, db))
+	assert.True(t, strings.HasPrefix(buf.String(), `{"schemaVersion":1,`))
+
+	loaded, err := client.LoadJSON(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Exclude, loaded.Exclude)
+	assert.Equal(t, db.Probes, loaded.Probes)
+
+	null := loaded.Probe("TCP", "NULL")
+	result := loaded.MatchResponse(null, []byte("SSH-2.0-OpenSSH_9.6\r\n"))
+	if assert.NotNil(t, result) {
+		assert.Equal(t, "ssh", result.Service)
+	}
+}
+
+func TestLoadJSONInvalid(t *testing.T) {
+	docs := []string{
+		`{"schemaVersion":2,"probes":[]}`,
+		`{"schemaVersion":1,"probes":[],"unknown":true}`,
+		`{"schemaVersion":1,"probes":[{"protocol":"SCTP","probeName":"NULL","probeString":"","matches":[]}]}`,
+		`{"schemaVersion":1,"probes":[{"protocol":"TCP","probeName":"NULL","probeString":"","ports":["70000"],"matches":[]}]}`,
+		`{"schemaVersion":1,"probes":[{"protocol":"TCP","probeName":"NULL","probeString":"","matches":[{"service":"ftp","pattern":""}]}]}`,
+		`{"schemaVersion":1,"probes":[{"protocol":"TCP","probeName":"NULL","probeString":"","matches":[{"service":"ftp","pattern":"^220","versionInfo":{"cpe":[{"uri":"a:acme"}]}}]}]}`,
+	}
+	for _, doc := range docs {
+		_, err := client.LoadJSON(strings.NewReader(doc))
+		assert.ErrorIs(t, err, ErrJSONFormat, doc)
+	}
+}
+
+func TestJSONSchemaUpToDate(t *testing.T) {
+	schema, err := JSONSchema()
+	assert.Nil(t, err)
+
+	// regenerate with `go generate`
+	committed, err := os.ReadFile("nmap-service-probes.schema.json")
+	assert.Nil(t, err)
+	assert.Equal(t, string(committed), string(schema))
+}
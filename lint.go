@@ -0,0 +1,274 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LintSeverity how serious a lint issue is
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// LintCategory the kind of mistake a lint issue reports
+type LintCategory string
+
+const (
+	LintSyntax    LintCategory = "syntax"
+	LintRegex     LintCategory = "regex"
+	LintTemplate  LintCategory = "template"
+	LintFallback  LintCategory = "fallback"
+	LintPorts     LintCategory = "ports"
+	LintDuplicate LintCategory = "duplicate"
+	LintDirective LintCategory = "directive"
+)
+
+// LintIssue a mistake found in a probe file
+type LintIssue struct {
+	Severity LintSeverity `json:"severity"`
+	Category LintCategory `json:"category"`
+	Source   string       `json:"source,omitempty"`
+	Line     int          `json:"line,omitempty"`
+	Probe    string       `json:"probe,omitempty"`
+	Message  string       `json:"message"`
+}
+
+// String renders the issue as `file:line: severity: [category] message`
+func (i *LintIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s: [%s] %s", i.Source, i.Line, i.Severity, i.Category, i.Message)
+}
+
+// HasLintErrors reports whether any issue is an error
+func HasLintErrors(issues []*LintIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == LintError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// knownDirectives the line keywords of the nmap-service-probes format
+var knownDirectives = []string{"Exclude", "Probe", "match", "softmatch", "ports", "sslports",
+	"totalwaitms", "tcpwrappedms", "rarity", "fallback"}
+
+// LintNmapServiceProbe lints a probe file: lines the parser would skip are
+// reported with their line number, then the parsed model is checked with LintProbeDB
+func (c *Client) LintNmapServiceProbe(srcFilePath string) ([]*LintIssue, error) {
+	data, err := os.ReadFile(srcFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	issues, _, err := c.lintProbeData(data, srcFilePath)
+	return issues, err
+}
+
+// lintProbeData lints the content of a probe file and returns the database parsed along the way
+func (c *Client) lintProbeData(data []byte, source string) ([]*LintIssue, *ProbeDB, error) {
+	var issues []*LintIssue
+	report := func(lineNo int, severity LintSeverity, category LintCategory, format string, args ...interface{}) {
+		issues = append(issues, &LintIssue{Severity: severity, Category: category, Source: source,
+			Line: lineNo, Message: fmt.Sprintf(format, args...)})
+	}
+
+	inProbe := false
+	lineNo := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+		if strings.HasPrefix(line, "#") || len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		keyword := strings.SplitN(line, " ", 2)[0]
+		switch {
+		case !containsString(knownDirectives, keyword):
+			report(lineNo, LintWarning, LintSyntax, "unknown directive %q is ignored", keyword)
+		case keyword == "Probe":
+			inProbe = false
+			probe := c.NewProbe()
+			if err := parseProbeLine(line, probe); err != nil {
+				report(lineNo, LintError, LintSyntax, "%v", err)
+				continue
+			}
+			if probe.Protocol != "TCP" && probe.Protocol != "UDP" {
+				report(lineNo, LintError, LintSyntax, "unsupported protocol %q, the probe is skipped", probe.Protocol)
+				continue
+			}
+			inProbe = true
+		case keyword == "match", keyword == "softmatch":
+			if _, err := c.ParseMatch(line); err != nil {
+				report(lineNo, LintError, LintSyntax, "%v, the rule is skipped", err)
+			}
+			fallthrough
+		case keyword != "Exclude":
+			if !inProbe {
+				report(lineNo, LintError, LintSyntax, "%s before any Probe line", keyword)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	db, err := c.ParseProbeDBReader(bytes.NewReader(data), source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return append(issues, LintProbeDB(db)...), db, nil
+}
+
+// LintProbeDB checks a parsed probe database for mistakes: patterns Go cannot
+// compile, templates referencing missing groups, unknown fallbacks, invalid
+// ports and directives, and duplicate probes and patterns
+func LintProbeDB(db *ProbeDB) []*LintIssue {
+	var issues []*LintIssue
+	seenProbes := make(map[string]*Probe)
+
+	for _, p := range db.Probes {
+		report := func(line int, severity LintSeverity, category LintCategory, format string, args ...interface{}) {
+			issues = append(issues, &LintIssue{Severity: severity, Category: category, Source: p.Source,
+				Line: line, Probe: p.Protocol + " " + p.ProbeName, Message: fmt.Sprintf(format, args...)})
+		}
+
+		key := p.Protocol + " " + p.ProbeName
+		if first, ok := seenProbes[key]; ok {
+			report(p.Line, LintError, LintDuplicate, "probe %s already defined at line %d", key, first.Line)
+		} else {
+			seenProbes[key] = p
+		}
+
+		lintProbeDirectives(db, p, report)
+
+		seenPatterns := make(map[string]*Match)
+		for _, m := range p.Matches {
+			if m.Name == "" {
+				report(m.Line, LintError, LintSyntax, "match rule without a service name")
+			}
+			for _, flag := range m.PatternFlag {
+				if flag != 'i' && flag != 's' {
+					report(m.Line, LintWarning, LintRegex, "unknown pattern flag %q", flag)
+				}
+			}
+
+			patternKey := m.PatternFlag + " " + m.Pattern
+			if first, ok := seenPatterns[patternKey]; ok {
+				report(m.Line, LintWarning, LintDuplicate, "pattern duplicates the %s rule at line %d", first.Name, first.Line)
+			} else {
+				seenPatterns[patternKey] = m
+			}
+
+			groups := 0
+			re, err := CompilePattern(m)
+			if err != nil {
+				report(m.Line, LintWarning, LintRegex, "pattern does not compile in Go: %v", err)
+				groups = countCaptureGroups(m.Pattern)
+			} else {
+				groups = re.NumSubexp()
+			}
+
+			for _, field := range matchTemplates(m) {
+				for _, ref := range parseTemplate(field).refs() {
+					if ref.Group < 1 || ref.Group > groups {
+						report(m.Line, LintError, LintTemplate, "%s references group %d but the pattern has %d", ref, ref.Group, groups)
+					}
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+func lintProbeDirectives(db *ProbeDB, p *Probe, report func(int, LintSeverity, LintCategory, string, ...interface{})) {
+	if _, err := parsePortSpec(p.Ports); err != nil {
+		report(p.DirectiveLine("ports"), LintError, LintPorts, "ports: %v", err)
+	}
+	if _, err := parsePortSpec(p.SslPorts); err != nil {
+		report(p.DirectiveLine("sslports"), LintError, LintPorts, "sslports: %v", err)
+	}
+
+	if p.Rarity != "" {
+		if rarity, err := strconv.Atoi(p.Rarity); err != nil || rarity < 1 || rarity > 9 {
+			report(p.DirectiveLine("rarity"), LintError, LintDirective, "rarity %q is not between 1 and 9", p.Rarity)
+		}
+	}
+	for _, directive := range [][2]string{{"totalwaitms", p.TotalWaitMs}, {"tcpwrappedms", p.TcpWrappedMs}} {
+		name, value := directive[0], directive[1]
+		if value == "" {
+			continue
+		}
+		if ms, err := strconv.Atoi(value); err != nil || ms < 0 {
+			report(p.DirectiveLine(name), LintError, LintDirective, "%s %q is not a number of milliseconds", name, value)
+		}
+	}
+
+	if p.Fallback != "" {
+		for _, name := range strings.Split(p.Fallback, ",") {
+			name = strings.TrimSpace(name)
+			switch {
+			case db.Probe(p.Protocol, name) != nil:
+			case len(db.ProbesByName(name)) > 0:
+				report(p.DirectiveLine("fallback"), LintWarning, LintFallback, "fallback %q is not a %s probe, the %s one is used",
+					name, p.Protocol, db.ProbesByName(name)[0].Protocol)
+			default:
+				report(p.DirectiveLine("fallback"), LintError, LintFallback, "fallback %q is not defined", name)
+			}
+		}
+	}
+}
+
+// matchTemplates returns every version info field and CPE of a rule that may hold templates
+func matchTemplates(m *Match) []string {
+	if m.VersionInfo == nil {
+		return nil
+	}
+
+	v := m.VersionInfo
+	fields := []string{v.VendorProductName, v.Version, v.Info, v.Hostname, v.OperatingSystem, v.DeviceType}
+	for _, c := range v.Cpe {
+		fields = append(fields, formatCPETemplate(c))
+	}
+
+	return fields
+}
+
+// countCaptureGroups counts the capturing groups of a PCRE pattern Go cannot compile
+func countCaptureGroups(pattern string) (groups int) {
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+			// a `]` right after `[` or `[^` is a literal
+			if strings.HasPrefix(pattern[i+1:], "^]") {
+				i += 2
+			} else if strings.HasPrefix(pattern[i+1:], "]") {
+				i++
+			}
+		case c == '(':
+			rest := pattern[i+1:]
+			if !strings.HasPrefix(rest, "?") || strings.HasPrefix(rest, "?<") && !strings.HasPrefix(rest, "?<=") &&
+				!strings.HasPrefix(rest, "?<!") || strings.HasPrefix(rest, "?P<") || strings.HasPrefix(rest, "?'") {
+				groups++
+			}
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const lintSrc = `Exclude T:9100-9107
+match early m|^x|
+
+Probe TCP NULL q||
+totalwaitms soon
+match ftp m|^220 (\w+) FTP| p/$1 ftpd/ v/$4/
+match ftp m|^220 (\w+) FTP| p/duplicate/
+match http m|^HTTP/1\.[01] (?!404)| p/web/ i/$P(2)/
+match broken m|^never closed
+softmatch ssh m|^SSH-|x
+
+Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+ports 80,70000
+rarity 12
+fallback NULL,Nope
+Probe SCTP Init q||
+`
+
+func TestLintNmapServiceProbe(t *testing.T) {
+	srcFilePath := filepath.Join(t.TempDir(), "custom-probes")
+	assert.Nil(t, os.WriteFile(srcFilePath, []byte(lintSrc), 0644))
+
+	issues, err := client.LintNmapServiceProbe(srcFilePath)
+	assert.Nil(t, err)
+	assert.True(t, HasLintErrors(issues))
+
+	found := make(map[string]*LintIssue)
+	for _, issue := range issues {
+		found[string(issue.Category)+" "+issue.Message] = issue
+	}
+
+	expected := []struct {
+		key      string
+		line     int
+		severity LintSeverity
+	}{
+		{"syntax match before any Probe line", 2, LintError},
+		{"directive totalwaitms \"soon\" is not a number of milliseconds", 5, LintError},
+		{"template $4 references group 4 but the pattern has 1", 6, LintError},
+		{"duplicate pattern duplicates the ftp rule at line 6", 7, LintWarning},
+		{"template $P(2) references group 2 but the pattern has 0", 8, LintError},
+		{"syntax match line is malformed, the rule is skipped", 9, LintError},
+		{"regex unknown pattern flag 'x'", 10, LintWarning},
+		{"ports ports: 70000: invalid port specification", 13, LintError},
+		{"directive rarity \"12\" is not between 1 and 9", 14, LintError},
+		{"fallback fallback \"Nope\" is not defined", 15, LintError},
+		{"syntax unsupported protocol \"SCTP\", the probe is skipped", 16, LintError},
+	}
+	for _, e := range expected {
+		issue, ok := found[e.key]
+		if assert.True(t, ok, e.key) {
+			assert.Equal(t, e.line, issue.Line, e.key)
+			assert.Equal(t, e.severity, issue.Severity, e.key)
+			assert.Equal(t, srcFilePath, issue.Source)
+		}
+	}
+
+	_, ok := found["regex pattern does not compile in Go: error parsing regexp: invalid or unsupported Perl syntax: `(?!`"]
+	assert.True(t, ok)
+}
+
+func TestLintIssueOrder(t *testing.T) {
+	srcFilePath := filepath.Join(t.TempDir(), "custom-probes")
+	assert.Nil(t, os.WriteFile(srcFilePath, []byte("Probe TCP NULL q||\ntcpwrappedms late\ntotalwaitms soon\n"), 0644))
+
+	// issues come in a stable order, directives in the order lint checks them
+	for i := 0; i < 10; i++ {
+		issues, err := client.LintNmapServiceProbe(srcFilePath)
+		assert.Nil(t, err)
+		if assert.Len(t, issues, 2) {
+			assert.Equal(t, 3, issues[0].Line)
+			assert.Equal(t, 2, issues[1].Line)
+		}
+	}
+}
+
+func TestLintBundledProbes(t *testing.T) {
+	issues, err := client.LintNmapServiceProbe("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+	assert.False(t, HasLintErrors(issues))
+}
+
+func TestCountCaptureGroups(t *testing.T) {
+	assert.Equal(t, 2, countCaptureGroups(`^(a)(?:b)(?!c)[(]\((d)`))
+	assert.Equal(t, 1, countCaptureGroups(`^(?<name>x)(?<=y)`))
+}
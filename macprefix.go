@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrMACPrefixLine = errors.New("nmap-mac-prefixes line is malformed")
+	ErrMACAddress    = errors.New("invalid MAC address")
+)
+
+// MACPrefix a line of nmap-mac-prefixes: the leading hex digits of the MAC
+// addresses assigned to a vendor, 6 for an OUI and more for smaller blocks
+type MACPrefix struct {
+	Prefix string `json:"prefix"`
+	Vendor string `json:"vendor"`
+	Line   int    `json:"line,omitempty"`
+}
+
+// MACPrefixTable a parsed nmap-mac-prefixes file with vendor lookup by MAC address
+type MACPrefixTable struct {
+	Prefixes []*MACPrefix `json:"prefixes"`
+
+	// byLength the prefixes by their number of hex digits, tried longest first
+	byLength map[int]map[string]*MACPrefix
+	lengths  []int
+}
+
+// NewMACPrefixTable builds the lookup of prefixes, the first of duplicate prefixes wins
+func NewMACPrefixTable(prefixes []*MACPrefix) *MACPrefixTable {
+	t := &MACPrefixTable{Prefixes: prefixes, byLength: make(map[int]map[string]*MACPrefix)}
+	for _, p := range prefixes {
+		byPrefix, ok := t.byLength[len(p.Prefix)]
+		if !ok {
+			byPrefix = make(map[string]*MACPrefix)
+			t.byLength[len(p.Prefix)] = byPrefix
+			t.lengths = append(t.lengths, len(p.Prefix))
+		}
+		if _, ok = byPrefix[p.Prefix]; !ok {
+			byPrefix[p.Prefix] = p
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(t.lengths)))
+
+	return t
+}
+
+// ParseNmapMACPrefixes parse an nmap-mac-prefixes file
+func (c *Client) ParseNmapMACPrefixes(srcFilePath string) (*MACPrefixTable, error) {
+	file, err := os.Open(srcFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return c.ParseNmapMACPrefixesReader(file, srcFilePath)
+}
+
+// ParseNmapMACPrefixesReader parse the nmap-mac-prefixes format from r,
+// source names the origin reported in errors
+func (c *Client) ParseNmapMACPrefixesReader(r io.Reader, source string) (*MACPrefixTable, error) {
+	var prefixes []*MACPrefix
+	lineNo := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lineNo++
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		prefix, vendor, _ := strings.Cut(line, " ")
+		vendor = strings.TrimSpace(vendor)
+		if len(prefix) < 6 || len(prefix) > 12 || !isHex(prefix) || vendor == "" {
+			return nil, errors.WithMessagef(ErrMACPrefixLine, "%s:%d: %s", source, lineNo, line)
+		}
+		prefixes = append(prefixes, &MACPrefix{Prefix: strings.ToUpper(prefix), Vendor: vendor, Line: lineNo})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewMACPrefixTable(prefixes), nil
+}
+
+// NormalizeMAC returns the 12 upper case hex digits of a MAC address written
+// as 00:1b:63:84:45:e6, 00-1B-63-84-45-E6, 001b.6384.45e6 or 001B638445E6
+func NormalizeMAC(mac string) (string, error) {
+	var sb strings.Builder
+	sb.Grow(12)
+	for i := 0; i < len(mac); i++ {
+		switch c := mac[i]; {
+		case c == ':' || c == '-' || c == '.':
+		case '0' <= c && c <= '9', 'A' <= c && c <= 'F':
+			sb.WriteByte(c)
+		case 'a' <= c && c <= 'f':
+			sb.WriteByte(c - 'a' + 'A')
+		default:
+			return "", errors.WithMessage(ErrMACAddress, mac)
+		}
+	}
+	if sb.Len() != 12 {
+		return "", errors.WithMessage(ErrMACAddress, mac)
+	}
+
+	return sb.String(), nil
+}
+
+// Lookup returns the longest prefix of a MAC address in any notation
+// NormalizeMAC accepts, nil when no prefix matches or the address is invalid
+func (t *MACPrefixTable) Lookup(mac string) *MACPrefix {
+	normalized, err := NormalizeMAC(mac)
+	if err != nil {
+		return nil
+	}
+
+	for _, length := range t.lengths {
+		if p, ok := t.byLength[length][normalized[:length]]; ok {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Vendor returns the vendor of a MAC address, empty when it is unknown
+func (t *MACPrefixTable) Vendor(mac string) string {
+	if p := t.Lookup(mac); p != nil {
+		return p.Vendor
+	}
+
+	return ""
+}
@@ -0,0 +1,42 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMAC(t *testing.T) {
+	for _, mac := range []string{"00:1b:63:84:45:e6", "00-1B-63-84-45-E6", "001b.6384.45e6", "001B638445E6"} {
+		normalized, err := NormalizeMAC(mac)
+		assert.Nil(t, err, mac)
+		assert.Equal(t, "001B638445E6", normalized)
+	}
+
+	for _, bad := range []string{"00:1b:63:84:45", "00:1b:63:84:45:e6:00", "00:1g:63:84:45:e6", ""} {
+		_, err := NormalizeMAC(bad)
+		assert.ErrorIs(t, err, ErrMACAddress, bad)
+	}
+}
+
+func TestMACPrefixTable(t *testing.T) {
+	table, err := client.ParseNmapMACPrefixes("./tests/nmap-mac-prefixes")
+	assert.Nil(t, err)
+	assert.Len(t, table.Prefixes, 12)
+
+	assert.Equal(t, "Apple", table.Vendor("00:1b:63:84:45:e6"))
+	assert.Equal(t, "VMware", table.Vendor("000c.2912.3456"))
+	// the longest prefix wins over the OUI of the registration authority
+	assert.Equal(t, "JMBS Developpements", table.Vendor("00-50-C2-00-1A-BC"))
+	assert.Equal(t, "IEEE Registration Authority", table.Vendor("00-50-C2-FF-1A-BC"))
+	assert.Equal(t, "TELEPLATFORMS", table.Vendor("70:b3:d5:f2:f0:01"))
+	assert.Equal(t, "LifeSmart", table.Vendor("f8:b5:68:01:02:03"))
+	assert.Equal(t, 15, table.Lookup("f8:b5:68:01:02:03").Line)
+
+	assert.Equal(t, "", table.Vendor("12:34:56:78:9a:bc"))
+	assert.Nil(t, table.Lookup("not a mac"))
+
+	_, err = client.ParseNmapMACPrefixesReader(strings.NewReader("00ZZ11 Broken\n"), "bad")
+	assert.ErrorIs(t, err, ErrMACPrefixLine)
+}
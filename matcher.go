@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// latin1String maps every byte to the rune of the same value, so Go's UTF-8
+// based regexp engine matches raw bytes the way nmap's PCRE does
+func latin1String(b []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(b))
+	for _, c := range b {
+		if c < utf8.RuneSelf {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteRune(rune(c))
+	}
+
+	return sb.String()
+}
+
+// latin1Bytes reverses latin1String
+func latin1Bytes(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		b = append(b, byte(r))
+	}
+
+	return b
+}
+
+// goPattern translates an nmap pattern and its flags to Go regexp syntax
+func goPattern(m *Match) string {
+	flags := ""
+	if strings.Contains(m.PatternFlag, "i") {
+		flags += "i"
+	}
+	if strings.Contains(m.PatternFlag, "s") {
+		flags += "s"
+	}
+
+	pattern := latin1String([]byte(m.Pattern))
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+
+	return pattern
+}
+
+// CompilePattern compiles the pattern of a match rule with its `i` and `s`
+// flags applied. Patterns are compiled for byte-wise matching, so subjects
+// have to go through the matching helpers of this package. PCRE features Go
+// does not support, such as lookaround and back references, return an error.
+func CompilePattern(m *Match) (*regexp.Regexp, error) {
+	return regexp.Compile(goPattern(m))
+}
+
+// compiledPattern the result of compiling the pattern of a rule
+type compiledPattern struct {
+	re  *regexp.Regexp
+	err error
+}
+
+// MatchResult a response identified by a match rule
+type MatchResult struct {
+	Probe   *Probe `json:"-"`
+	Match   *Match `json:"match"`
+	Service string `json:"service"`
+	Soft    bool   `json:"soft,omitempty"`
+	// Captures the groups of the pattern, the whole match first
+	Captures    [][]byte `json:"-"`
+	VersionInfo *VInfo   `json:"versionInfo,omitempty"`
+}
+
+// CompiledPattern returns the compiled pattern of a rule of the database,
+// compiling it on first use
+func (db *ProbeDB) CompiledPattern(m *Match) (*regexp.Regexp, error) {
+	if cached, ok := db.compiled.Load(m); ok {
+		return cached.(*compiledPattern).re, cached.(*compiledPattern).err
+	}
+
+	re, err := CompilePattern(m)
+	db.compiled.Store(m, &compiledPattern{re: re, err: err})
+
+	return re, err
+}
+
+// MatchRule runs a rule against a response and returns its captures, the whole
+// match first, or nil when it does not match. Rules Go cannot compile never match.
+func (db *ProbeDB) MatchRule(m *Match, response []byte) [][]byte {
+	return db.matchSubject(m, latin1String(response))
+}
+
+// matchSubject runs a rule against a response in the one rune per byte form
+func (db *ProbeDB) matchSubject(m *Match, subject string) [][]byte {
+	re, err := db.CompiledPattern(m)
+	if err != nil {
+		return nil
+	}
+
+	groups := re.FindStringSubmatchIndex(subject)
+	if groups == nil {
+		return nil
+	}
+
+	captures := make([][]byte, len(groups)/2)
+	for i := range captures {
+		if groups[2*i] >= 0 {
+			captures[i] = latin1Bytes(subject[groups[2*i]:groups[2*i+1]])
+		}
+	}
+
+	return captures
+}
+
+// FallbackChain returns the probes whose rules nmap tries on the response to p:
+// p itself, the probes of its fallback directive and, for TCP, the NULL probe
+func (db *ProbeDB) FallbackChain(p *Probe) []*Probe {
+	chain := []*Probe{p}
+	if p.Fallback != "" {
+		for _, name := range strings.Split(p.Fallback, ",") {
+			name = strings.TrimSpace(name)
+			fallback := db.Probe(p.Protocol, name)
+			if fallback == nil && len(db.ProbesByName(name)) > 0 {
+				fallback = db.ProbesByName(name)[0]
+			}
+			if fallback != nil && !containsProbe(chain, fallback) {
+				chain = append(chain, fallback)
+			}
+		}
+	}
+	if null := db.Probe("TCP", "NULL"); p.Protocol == "TCP" && null != nil && !containsProbe(chain, null) {
+		chain = append(chain, null)
+	}
+
+	return chain
+}
+
+// MatchResponse identifies the response to a probe the way nmap does: the
+// rules of the probe and its fallback chain are tried in order, the first hard
+// match wins, and after a softmatch only rules of the same service are tried.
+// It returns the softmatch when no hard match follows, nil when nothing matches.
+// Only the rules whose required literal occurs in the response run their
+// pattern, see prefilter.go.
+func (db *ProbeDB) MatchResponse(p *Probe, response []byte) *MatchResult {
+	return db.matchResponse(p, response, true)
+}
+
+func (db *ProbeDB) matchResponse(p *Probe, response []byte, prefilter bool) *MatchResult {
+	subject := latin1String(response)
+	var soft *MatchResult
+	for _, probe := range db.FallbackChain(p) {
+		var candidates []bool
+		if prefilter {
+			candidates = db.prefilter(probe).candidates(subject)
+		}
+		for i, m := range probe.Matches {
+			if candidates != nil && !candidates[i] || soft != nil && m.Name != soft.Service {
+				continue
+			}
+			captures := db.matchSubject(m, subject)
+			if captures == nil {
+				continue
+			}
+
+			result := db.newMatchResult(probe, m, captures)
+			if !m.Soft {
+				return result
+			}
+			if soft == nil {
+				soft = result
+			}
+		}
+	}
+
+	return soft
+}
+
+func (db *ProbeDB) newMatchResult(p *Probe, m *Match, captures [][]byte) *MatchResult {
+	result := &MatchResult{Probe: p, Match: m, Service: m.Name, Soft: m.Soft, Captures: captures}
+	if m.VersionInfo != nil {
+		result.VersionInfo = db.fillVersionInfo(m, captures)
+	}
+
+	return result
+}
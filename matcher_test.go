@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeEscapes(t *testing.T) {
+	b, err := DecodeEscapes(`\0\x1E\r\n\|a\\`)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 0x1e, '\r', '\n', '|', 'a', '\\'}, b)
+
+	_, err = DecodeEscapes(`\x4`)
+	assert.ErrorIs(t, err, ErrEscape)
+	_, err = DecodeEscapes(`abc\`)
+	assert.ErrorIs(t, err, ErrEscape)
+}
+
+func TestMatchResponse(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+
+	null := db.Probe("TCP", "NULL")
+	result := db.MatchResponse(null, []byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1\r\n"))
+	if assert.NotNil(t, result) {
+		assert.Equal(t, "ssh", result.Service)
+		assert.False(t, result.Soft)
+		assert.Equal(t, "OpenSSH", result.VersionInfo.VendorProductName)
+		assert.Equal(t, "8.9p1 Ubuntu 3ubuntu0.1", result.VersionInfo.Version)
+		assert.Equal(t, null, result.Probe)
+	}
+
+	// bytes above 0x7f are matched one by one, as by nmap
+	result = db.MatchResponse(null, []byte("\xc4\x00\x00\x00\x0a5.7.42\x00"))
+	if assert.NotNil(t, result) {
+		assert.Equal(t, "mysql", result.Service)
+		assert.Equal(t, "5.7.42", result.VersionInfo.Version)
+	}
+
+	// GetRequest falls back to the NULL probe
+	getRequest := db.Probe("TCP", "GetRequest")
+	assert.Equal(t, []*Probe{getRequest, null}, db.FallbackChain(getRequest))
+	result = db.MatchResponse(getRequest, []byte("220 ProFTPD 1.3.5 Server (Debian) [::ffff:10.0.0.1]\r\n"))
+	if assert.NotNil(t, result) {
+		assert.Equal(t, "ftp", result.Service)
+		assert.Equal(t, null, result.Probe)
+	}
+
+	assert.Nil(t, db.MatchResponse(null, []byte("\x00\x01nothing known")))
+}
+
+func TestMatchResponseSoftmatch(t *testing.T) {
+	src := `Probe TCP NULL q||
+softmatch ftp m|^220 |
+match smtp m|^220 .* ESMTP| p/generic smtp/
+match ftp m|^220 ([\w.]+) FTP| p/$1/ v/$2/
+`
+	db, err := client.ParseProbeDBReader(strings.NewReader(src), "soft")
+	assert.Nil(t, err)
+
+	// rules of other services are skipped after the softmatch
+	result := db.MatchResponse(db.Probes[0], []byte("220 mail ESMTP\r\n"))
+	if assert.NotNil(t, result) {
+		assert.True(t, result.Soft)
+		assert.Equal(t, "ftp", result.Service)
+	}
+
+	result = db.MatchResponse(db.Probes[0], []byte("220 vsftpd FTP\r\n"))
+	if assert.NotNil(t, result) {
+		assert.False(t, result.Soft)
+		assert.Equal(t, "vsftpd", result.VersionInfo.VendorProductName)
+		assert.Equal(t, "", result.VersionInfo.Version)
+		assert.Equal(t, 4, result.Match.Line)
+	}
+}
@@ -0,0 +1,259 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrMergeConflict = errors.New("probe defined more than once")
+
+// MergeStrategy decides what happens to a probe whose protocol and name already exist
+type MergeStrategy int
+
+const (
+	// MergeAppend appends the matches of the later probe to the earlier one
+	MergeAppend MergeStrategy = iota
+	// MergeReplace replaces the earlier probe with the later one
+	MergeReplace
+	// MergeError fails on the first probe defined twice
+	MergeError
+)
+
+// MatchPosition decides where appended matches are inserted
+type MatchPosition int
+
+const (
+	// MatchesAfter inserts the later matches after the existing ones
+	MatchesAfter MatchPosition = iota
+	// MatchesBefore inserts the later matches before the existing ones, so they take priority
+	MatchesBefore
+)
+
+// ParseMergeStrategy parse `append`, `replace` or `error`
+func ParseMergeStrategy(s string) (MergeStrategy, error) {
+	switch s {
+	case "append":
+		return MergeAppend, nil
+	case "replace":
+		return MergeReplace, nil
+	case "error":
+		return MergeError, nil
+	}
+
+	return 0, errors.Errorf("unknown merge strategy %q", s)
+}
+
+// ParseMatchPosition parse `after` or `before`
+func ParseMatchPosition(s string) (MatchPosition, error) {
+	switch s {
+	case "after":
+		return MatchesAfter, nil
+	case "before":
+		return MatchesBefore, nil
+	}
+
+	return 0, errors.Errorf("unknown match position %q", s)
+}
+
+// MergeOptions options of MergeProbeDBs
+type MergeOptions struct {
+	Strategy MergeStrategy
+	Position MatchPosition
+}
+
+// MergeConflict a probe defined by more than one database and how it was resolved
+type MergeConflict struct {
+	Protocol   string   `json:"protocol"`
+	ProbeName  string   `json:"probeName"`
+	Sources    []string `json:"sources"`
+	Resolution string   `json:"resolution"`
+	Details    []string `json:"details,omitempty"`
+}
+
+// ShadowedRule a rule that can never be reached because of an earlier rule.
+// Merging reports earlier hard matches with the same pattern and flags,
+// FindShadowedRules also broader earlier rules along with the number of
+// samples the rule matched.
+type ShadowedRule struct {
+	Protocol  string `json:"protocol"`
+	ProbeName string `json:"probeName"`
+	Rule      *Match `json:"rule"`
+	By        *Match `json:"by"`
+	Samples   int    `json:"samples,omitempty"`
+}
+
+// String renders the shadowed rule for humans
+func (s *ShadowedRule) String() string {
+	return fmt.Sprintf("shadowed: %s %s %s at %s:%d by %s at %s:%d", s.Protocol, s.ProbeName,
+		s.Rule.Name, s.Rule.Source, s.Rule.Line, s.By.Name, s.By.Source, s.By.Line)
+}
+
+// MergeReport the conflicts and shadowed rules found while merging
+type MergeReport struct {
+	Conflicts []*MergeConflict `json:"conflicts"`
+	Shadowed  []*ShadowedRule  `json:"shadowed"`
+}
+
+// String renders the report for humans
+func (r *MergeReport) String() string {
+	var sb strings.Builder
+	for _, c := range r.Conflicts {
+		fmt.Fprintf(&sb, "conflict: %s %s defined in %s: %s\n", c.Protocol, c.ProbeName, strings.Join(c.Sources, ", "), c.Resolution)
+		for _, detail := range c.Details {
+			fmt.Fprintf(&sb, "    %s\n", detail)
+		}
+	}
+	for _, s := range r.Shadowed {
+		fmt.Fprintln(&sb, s)
+	}
+
+	return sb.String()
+}
+
+// MergeProbeDBs merges probe databases in order, later ones layered on top of
+// earlier ones. The inputs are not modified.
+func MergeProbeDBs(opts MergeOptions, dbs ...*ProbeDB) (*ProbeDB, *MergeReport, error) {
+	report := &MergeReport{}
+	var probes []*Probe
+	var exclude []string
+	index := make(map[string]int)
+
+	for _, db := range dbs {
+		for _, item := range db.Exclude {
+			if !containsString(exclude, item) {
+				exclude = append(exclude, item)
+			}
+		}
+
+		for _, p := range db.Probes {
+			key := p.Protocol + " " + p.ProbeName
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(probes)
+				probes = append(probes, copyProbe(p))
+				continue
+			}
+
+			existing := probes[i]
+			conflict := &MergeConflict{
+				Protocol:  p.Protocol,
+				ProbeName: p.ProbeName,
+				Sources:   []string{existing.Source, p.Source},
+				Details:   diffProbeDirectives(existing, p),
+			}
+			report.Conflicts = append(report.Conflicts, conflict)
+
+			switch opts.Strategy {
+			case MergeError:
+				return nil, report, errors.WithMessagef(ErrMergeConflict, "%s %s in %s and %s",
+					p.Protocol, p.ProbeName, existing.Source, p.Source)
+			case MergeReplace:
+				conflict.Resolution = "replaced"
+				probes[i] = copyProbe(p)
+			default:
+				conflict.Resolution = fmt.Sprintf("appended %d matches", len(p.Matches))
+				appendProbe(existing, p, opts.Position)
+			}
+		}
+	}
+
+	for _, p := range probes {
+		report.Shadowed = append(report.Shadowed, findDuplicateRules(p)...)
+	}
+
+	merged := NewProbeDB(probes, exclude...)
+
+	return merged, report, nil
+}
+
+func copyProbe(p *Probe) *Probe {
+	cp := *p
+	cp.Matches = append([]*Match{}, p.Matches...)
+	cp.Ports = append([]string(nil), p.Ports...)
+	cp.SslPorts = append([]string(nil), p.SslPorts...)
+
+	return &cp
+}
+
+// appendProbe layers the matches and missing directives of src on dst
+func appendProbe(dst, src *Probe, position MatchPosition) {
+	if position == MatchesBefore {
+		dst.Matches = append(append([]*Match{}, src.Matches...), dst.Matches...)
+	} else {
+		dst.Matches = append(dst.Matches, src.Matches...)
+	}
+
+	for _, port := range src.Ports {
+		if !containsString(dst.Ports, port) {
+			dst.Ports = append(dst.Ports, port)
+		}
+	}
+	for _, port := range src.SslPorts {
+		if !containsString(dst.SslPorts, port) {
+			dst.SslPorts = append(dst.SslPorts, port)
+		}
+	}
+
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&dst.Rarity, src.Rarity)
+	fill(&dst.TotalWaitMs, src.TotalWaitMs)
+	fill(&dst.TcpWrappedMs, src.TcpWrappedMs)
+	fill(&dst.Fallback, src.Fallback)
+}
+
+// diffProbeDirectives describes the directives two definitions of a probe disagree on
+func diffProbeDirectives(a, b *Probe) []string {
+	var details []string
+	fields := []struct {
+		name string
+		a, b string
+	}{
+		{"probe string", a.ProbeString, b.ProbeString},
+		{"ports", strings.Join(a.Ports, ","), strings.Join(b.Ports, ",")},
+		{"sslports", strings.Join(a.SslPorts, ","), strings.Join(b.SslPorts, ",")},
+		{"rarity", a.Rarity, b.Rarity},
+		{"totalwaitms", a.TotalWaitMs, b.TotalWaitMs},
+		{"tcpwrappedms", a.TcpWrappedMs, b.TcpWrappedMs},
+		{"fallback", a.Fallback, b.Fallback},
+	}
+	for _, f := range fields {
+		if f.a != f.b && f.b != "" {
+			details = append(details, fmt.Sprintf("%s: %q vs %q", f.name, f.a, f.b))
+		}
+	}
+
+	return details
+}
+
+// findDuplicateRules finds rules preceded by a hard match with the same pattern and flags
+func findDuplicateRules(p *Probe) (shadowed []*ShadowedRule) {
+	hard := make(map[string]*Match)
+	for _, m := range p.Matches {
+		key := m.PatternFlag + " " + m.Pattern
+		if by, ok := hard[key]; ok {
+			shadowed = append(shadowed, &ShadowedRule{Protocol: p.Protocol, ProbeName: p.ProbeName, Rule: m, By: by})
+			continue
+		}
+		if !m.Soft {
+			hard[key] = m
+		}
+	}
+
+	return shadowed
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
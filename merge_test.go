@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const mergeBase = `Exclude T:9100-9107
+
+Probe TCP NULL q||
+totalwaitms 6000
+
+match ftp m|^220 FTP\r\n| p/generic ftpd/
+match ssh m|^SSH-| p/generic sshd/
+`
+
+const mergeCustom = `Probe TCP NULL q||
+ports 2121
+
+match ftp m|^220 Acme FTP\r\n| p/Acme ftpd/
+match ftp m|^220 FTP\r\n| p/never reached/
+
+Probe TCP AcmeHello q|HELLO {$host}\r\n|
+match acme m|^ACME| p/Acme service/
+`
+
+func parseMergeInputs(t *testing.T) (*ProbeDB, *ProbeDB) {
+	base, err := client.ParseProbeDBReader(strings.NewReader(mergeBase), "base")
+	assert.Nil(t, err)
+	custom, err := client.ParseProbeDBReader(strings.NewReader(mergeCustom), "custom")
+	assert.Nil(t, err)
+
+	return base, custom
+}
+
+func TestMergeProbeDBsAppend(t *testing.T) {
+	base, custom := parseMergeInputs(t)
+
+	merged, report, err := MergeProbeDBs(MergeOptions{Strategy: MergeAppend, Position: MatchesBefore}, base, custom)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, merged.Len())
+	assert.Equal(t, []string{"T:9100-9107"}, merged.Exclude)
+
+	null := merged.Probe("TCP", "NULL")
+	assert.Equal(t, 4, len(null.Matches))
+	assert.Equal(t, "Acme ftpd", null.Matches[0].VersionInfo.VendorProductName)
+	assert.Equal(t, []string{"2121"}, null.Ports)
+	assert.Equal(t, "6000", null.TotalWaitMs)
+
+	// the inputs stay untouched
+	assert.Equal(t, 2, len(base.Probes[0].Matches))
+
+	assert.Equal(t, 1, len(report.Conflicts))
+	assert.Equal(t, []string{"base", "custom"}, report.Conflicts[0].Sources)
+
+	// the generic rule is now preceded by the custom duplicate
+	assert.Equal(t, 1, len(report.Shadowed))
+	assert.Equal(t, "generic ftpd", report.Shadowed[0].Rule.VersionInfo.VendorProductName)
+	assert.Equal(t, "never reached", report.Shadowed[0].By.VersionInfo.VendorProductName)
+}
+
+func TestMergeProbeDBsReplaceAndError(t *testing.T) {
+	base, custom := parseMergeInputs(t)
+
+	merged, _, err := MergeProbeDBs(MergeOptions{Strategy: MergeReplace}, base, custom)
+	assert.Nil(t, err)
+	assert.Equal(t, "custom", merged.Probe("TCP", "NULL").Source)
+	assert.Equal(t, "", merged.Probe("TCP", "NULL").TotalWaitMs)
+
+	_, report, err := MergeProbeDBs(MergeOptions{Strategy: MergeError}, base, custom)
+	assert.ErrorIs(t, err, ErrMergeConflict)
+	assert.Equal(t, 1, len(report.Conflicts))
+}
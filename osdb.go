@@ -0,0 +1,359 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrOSDBLine = errors.New("nmap-os-db line is malformed")
+	ErrOSExpr   = errors.New("nmap-os-db expression is malformed")
+)
+
+// OSExprOp the comparison of an expression term
+type OSExprOp string
+
+const (
+	// OSExprEqual the value is Value
+	OSExprEqual OSExprOp = "eq"
+	// OSExprRange the hex value is between Low and High, both included
+	OSExprRange OSExprOp = "range"
+	// OSExprGreater the hex value is greater than Value
+	OSExprGreater OSExprOp = "gt"
+	// OSExprLess the hex value is less than Value
+	OSExprLess OSExprOp = "lt"
+)
+
+// OSExprTerm an alternative of an expression such as `F7-101` or `>10`
+type OSExprTerm struct {
+	Op    OSExprOp `json:"op"`
+	Value string   `json:"value,omitempty"`
+	Low   string   `json:"low,omitempty"`
+	High  string   `json:"high,omitempty"`
+}
+
+// String renders the term as it is written in nmap-os-db
+func (t OSExprTerm) String() string {
+	switch t.Op {
+	case OSExprRange:
+		return t.Low + "-" + t.High
+	case OSExprGreater:
+		return ">" + t.Value
+	case OSExprLess:
+		return "<" + t.Value
+	}
+
+	return t.Value
+}
+
+// OSExpr the alternatives an attribute value may match, separated by `|`
+type OSExpr []OSExprTerm
+
+// String renders the expression as it is written in nmap-os-db
+func (e OSExpr) String() string {
+	terms := make([]string, len(e))
+	for i, t := range e {
+		terms[i] = t.String()
+	}
+
+	return strings.Join(terms, "|")
+}
+
+// ParseOSExpr parse an attribute expression such as `GCD=1-6|>10` without
+// the name: alternatives separated by `|`, each a hex range `low-high`, a hex
+// bound `>n` or `<n`, or a value compared as is. An empty value is allowed.
+func ParseOSExpr(s string) (OSExpr, error) {
+	alternatives := strings.Split(s, "|")
+	expr := make(OSExpr, 0, len(alternatives))
+	for _, alt := range alternatives {
+		switch {
+		case strings.HasPrefix(alt, ">"), strings.HasPrefix(alt, "<"):
+			if !isHex(alt[1:]) {
+				return nil, errors.WithMessagef(ErrOSExpr, "%q: bound %q is not a hex number", s, alt)
+			}
+			op := OSExprGreater
+			if alt[0] == '<' {
+				op = OSExprLess
+			}
+			expr = append(expr, OSExprTerm{Op: op, Value: alt[1:]})
+		case isHexRange(alt):
+			low, high, _ := strings.Cut(alt, "-")
+			if parseHex(low) > parseHex(high) {
+				return nil, errors.WithMessagef(ErrOSExpr, "%q: range %q is reversed", s, alt)
+			}
+			expr = append(expr, OSExprTerm{Op: OSExprRange, Low: low, High: high})
+		default:
+			expr = append(expr, OSExprTerm{Op: OSExprEqual, Value: alt})
+		}
+	}
+
+	return expr, nil
+}
+
+func isHex(s string) bool {
+	if s == "" || len(s) > 16 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", rune(s[i])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isHexRange(s string) bool {
+	low, high, ok := strings.Cut(s, "-")
+	return ok && isHex(low) && isHex(high)
+}
+
+// parseHex parses a value isHex accepted
+func parseHex(s string) uint64 {
+	n, _ := strconv.ParseUint(s, 16, 64)
+	return n
+}
+
+// OSAttribute an attribute of a test line, Value the expression as written
+type OSAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Expr  OSExpr `json:"expr"`
+}
+
+// OSTest a test line such as `SEQ(SP=F7-101%GCD=1-6)` of a fingerprint or of MatchPoints
+type OSTest struct {
+	Name       string         `json:"name"`
+	Attributes []*OSAttribute `json:"attributes"`
+}
+
+// Attribute returns the attribute with the given name, nil if there is none
+func (t *OSTest) Attribute(name string) *OSAttribute {
+	for _, a := range t.Attributes {
+		if a.Name == name {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// OSCPE a CPE line of a class, Auto when nmap may append version details to it
+type OSCPE struct {
+	URI  string `json:"uri"`
+	Auto bool   `json:"auto,omitempty"`
+}
+
+// OSClass a Class line, `vendor | family | generation | device type`, with its CPE lines
+type OSClass struct {
+	Vendor     string   `json:"vendor"`
+	Family     string   `json:"family"`
+	Generation string   `json:"generation,omitempty"`
+	DeviceType string   `json:"deviceType"`
+	Cpe        []*OSCPE `json:"cpe,omitempty"`
+}
+
+// OSFingerprint a reference fingerprint of nmap-os-db
+type OSFingerprint struct {
+	Name    string     `json:"name"`
+	Classes []*OSClass `json:"classes"`
+	Tests   []*OSTest  `json:"tests"`
+	Source  string     `json:"source,omitempty"`
+	Line    int        `json:"line,omitempty"`
+	Comment string     `json:"comment,omitempty"`
+}
+
+// Test returns the test with the given name, nil if there is none
+func (fp *OSFingerprint) Test(name string) *OSTest {
+	for _, t := range fp.Tests {
+		if t.Name == name {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// OSDB a parsed nmap-os-db: the MatchPoints weights and the reference
+// fingerprints in file order
+type OSDB struct {
+	MatchPoints  []*OSTest        `json:"matchPoints"`
+	Fingerprints []*OSFingerprint `json:"fingerprints"`
+
+	byName map[string]*OSFingerprint
+	// weights the MatchPoints weights by `test.attribute`
+	weights map[string]int
+}
+
+// NewOSDB builds an OS database and its lookup by name
+func NewOSDB(matchPoints []*OSTest, fingerprints []*OSFingerprint) *OSDB {
+	db := &OSDB{MatchPoints: matchPoints, Fingerprints: fingerprints, byName: make(map[string]*OSFingerprint),
+		weights: make(map[string]int)}
+	for _, t := range matchPoints {
+		for _, a := range t.Attributes {
+			// weights that are not numbers count as 0, so the attribute is not compared
+			weight, _ := strconv.Atoi(a.Value)
+			db.weights[t.Name+"."+a.Name] = weight
+		}
+	}
+	for _, fp := range fingerprints {
+		if _, ok := db.byName[fp.Name]; !ok {
+			db.byName[fp.Name] = fp
+		}
+	}
+
+	return db
+}
+
+// Len returns the number of fingerprints
+func (db *OSDB) Len() int {
+	return len(db.Fingerprints)
+}
+
+// Fingerprint returns the first fingerprint with the given name, nil if there is none
+func (db *OSDB) Fingerprint(name string) *OSFingerprint {
+	return db.byName[name]
+}
+
+// Filter returns the fingerprints with a class accepted by fn, in file order
+func (db *OSDB) Filter(fn func(c *OSClass) bool) []*OSFingerprint {
+	var fingerprints []*OSFingerprint
+	for _, fp := range db.Fingerprints {
+		for _, c := range fp.Classes {
+			if fn(c) {
+				fingerprints = append(fingerprints, fp)
+				break
+			}
+		}
+	}
+
+	return fingerprints
+}
+
+// ParseNmapOSDB parse an nmap-os-db file
+func (c *Client) ParseNmapOSDB(srcFilePath string) (*OSDB, error) {
+	file, err := os.Open(srcFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return c.ParseNmapOSDBReader(file, srcFilePath)
+}
+
+// ParseNmapOSDBReader parse the nmap-os-db format from r, source names the
+// origin recorded in the Source fields
+func (c *Client) ParseNmapOSDBReader(r io.Reader, source string) (*OSDB, error) {
+	var matchPoints []*OSTest
+	var fingerprints []*OSFingerprint
+	// tests are added to the current fingerprint, or to MatchPoints
+	var current *OSFingerprint
+	inMatchPoints := false
+	var comments []string
+
+	lineNo := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		lineNo++
+		fail := func(err error) error {
+			return errors.WithMessagef(err, "%s:%d", source, lineNo)
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#"):
+			comments = append(comments, parseCommentLine(line))
+		case len(strings.TrimSpace(line)) == 0:
+			current, inMatchPoints, comments = nil, false, nil
+		case line == "MatchPoints":
+			current, inMatchPoints, comments = nil, true, nil
+		case strings.HasPrefix(line, "Fingerprint "):
+			current = &OSFingerprint{Name: strings.TrimSpace(line[len("Fingerprint "):]), Source: source, Line: lineNo,
+				Comment: joinComment(comments)}
+			fingerprints = append(fingerprints, current)
+			inMatchPoints, comments = false, nil
+		case strings.HasPrefix(line, "Class "):
+			if current == nil {
+				return nil, fail(errors.WithMessage(ErrOSDBLine, "Class outside of a fingerprint"))
+			}
+			class, err := parseOSClass(line[len("Class "):])
+			if err != nil {
+				return nil, fail(err)
+			}
+			current.Classes = append(current.Classes, class)
+		case strings.HasPrefix(line, "CPE "):
+			if current == nil || len(current.Classes) == 0 {
+				return nil, fail(errors.WithMessage(ErrOSDBLine, "CPE without a Class"))
+			}
+			class := current.Classes[len(current.Classes)-1]
+			fields := strings.Fields(line[len("CPE "):])
+			if len(fields) == 0 || len(fields) > 2 || len(fields) == 2 && fields[1] != "auto" {
+				return nil, fail(errors.WithMessage(ErrOSDBLine, line))
+			}
+			class.Cpe = append(class.Cpe, &OSCPE{URI: fields[0], Auto: len(fields) == 2})
+		default:
+			test, err := parseOSTest(line)
+			if err != nil {
+				return nil, fail(err)
+			}
+			switch {
+			case inMatchPoints:
+				matchPoints = append(matchPoints, test)
+			case current != nil:
+				current.Tests = append(current.Tests, test)
+			default:
+				return nil, fail(errors.WithMessage(ErrOSDBLine, "test outside of a fingerprint"))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewOSDB(matchPoints, fingerprints), nil
+}
+
+// parseOSClass parse `vendor | family | generation | device type`
+func parseOSClass(s string) (*OSClass, error) {
+	fields := strings.Split(s, "|")
+	if len(fields) != 4 {
+		return nil, errors.WithMessagef(ErrOSDBLine, "class %q has %d fields instead of 4", s, len(fields))
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	return &OSClass{Vendor: fields[0], Family: fields[1], Generation: fields[2], DeviceType: fields[3]}, nil
+}
+
+// parseOSTest parse a test line `NAME(attr=expr%attr=expr...)`
+func parseOSTest(line string) (*OSTest, error) {
+	open := strings.IndexByte(line, '(')
+	if open < 1 || !strings.HasSuffix(line, ")") {
+		return nil, errors.WithMessage(ErrOSDBLine, line)
+	}
+
+	test := &OSTest{Name: line[:open], Attributes: make([]*OSAttribute, 0)}
+	body := line[open+1 : len(line)-1]
+	if body == "" {
+		return test, nil
+	}
+	for _, item := range strings.Split(body, "%") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || name == "" {
+			return nil, errors.WithMessagef(ErrOSDBLine, "%s: attribute %q without a value", test.Name, item)
+		}
+		expr, err := ParseOSExpr(value)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "%s.%s", test.Name, name)
+		}
+		test.Attributes = append(test.Attributes, &OSAttribute{Name: name, Value: value, Expr: expr})
+	}
+
+	return test, nil
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOSExpr(t *testing.T) {
+	cases := []struct {
+		s    string
+		expr OSExpr
+	}{
+		{"1-6|>10", OSExpr{{Op: OSExprRange, Low: "1", High: "6"}, {Op: OSExprGreater, Value: "10"}}},
+		{"<1000", OSExpr{{Op: OSExprLess, Value: "1000"}}},
+		{"M5B4ST11NW7", OSExpr{{Op: OSExprEqual, Value: "M5B4ST11NW7"}}},
+		{"I|RD", OSExpr{{Op: OSExprEqual, Value: "I"}, {Op: OSExprEqual, Value: "RD"}}},
+		{"", OSExpr{{Op: OSExprEqual}}},
+	}
+	for _, c := range cases {
+		expr, err := ParseOSExpr(c.s)
+		assert.Nil(t, err, c.s)
+		assert.Equal(t, c.expr, expr, c.s)
+		assert.Equal(t, c.s, expr.String())
+	}
+
+	for _, bad := range []string{">x", "10-1"} {
+		_, err := ParseOSExpr(bad)
+		assert.ErrorIs(t, err, ErrOSExpr, bad)
+	}
+}
+
+func TestParseNmapOSDB(t *testing.T) {
+	db, err := client.ParseNmapOSDB("./tests/nmap-os-db")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, db.Len())
+	assert.Len(t, db.MatchPoints, 13)
+	assert.Equal(t, "75", db.MatchPoints[0].Attribute("GCD").Value)
+
+	linux := db.Fingerprint("Linux 4.15 - 5.19")
+	if assert.NotNil(t, linux) {
+		assert.Equal(t, "Linux 4.15 - 5.x, generic kernels", linux.Comment)
+		assert.Len(t, linux.Classes, 2)
+		assert.Equal(t, &OSClass{Vendor: "Linux", Family: "Linux", Generation: "5.X", DeviceType: "general purpose",
+			Cpe: []*OSCPE{{URI: "cpe:/o:linux:linux_kernel:5", Auto: true}}}, linux.Classes[1])
+		assert.Len(t, linux.Tests, 13)
+		assert.Equal(t, "FA-10A", linux.Test("SEQ").Attribute("SP").Value)
+		assert.Equal(t, OSExpr{{Op: OSExprEqual}}, linux.Test("T4").Attribute("O").Expr)
+	}
+
+	helios := db.Fingerprint("2N Helios IP VoIP doorbell")
+	if assert.NotNil(t, helios) {
+		assert.Equal(t, "", helios.Classes[0].Generation)
+		assert.Len(t, helios.Test("SEQ").Attribute("GCD").Expr, 4)
+	}
+
+	embedded := db.Filter(func(c *OSClass) bool { return c.DeviceType == "specialized" })
+	assert.Equal(t, []*OSFingerprint{helios}, embedded)
+
+	data, err := json.Marshal(db)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `{"name":"GCD","value":"1-6","expr":[{"op":"range","low":"1","high":"6"}]}`)
+
+	for _, bad := range []string{"Class a | b | c | d", "Fingerprint x\nClass a | b\n", "Fingerprint x\nCPE cpe:/o:x",
+		"Fingerprint x\nSEQ(SP)", "Fingerprint x\nSEQ(SP=>z)", "SEQ(SP=1)"} {
+		_, err = client.ParseNmapOSDBReader(strings.NewReader(bad), "bad")
+		assert.NotNil(t, err, bad)
+	}
+}
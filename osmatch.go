@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultOSMinAccuracy the lowest accuracy of the guesses returned by default
+const DefaultOSMinAccuracy = 0.85
+
+// Match reports whether a value of a subject fingerprint satisfies one of the
+// alternatives. Ranges and bounds compare hex numbers, other terms the value as is.
+func (e OSExpr) Match(value string) bool {
+	for _, t := range e {
+		if t.Match(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match reports whether a value of a subject fingerprint satisfies the term
+func (t OSExprTerm) Match(value string) bool {
+	if t.Op == OSExprEqual {
+		return value == t.Value
+	}
+	if !isHex(value) {
+		return false
+	}
+
+	n := parseHex(value)
+	switch t.Op {
+	case OSExprRange:
+		return parseHex(t.Low) <= n && n <= parseHex(t.High)
+	case OSExprGreater:
+		return n > parseHex(t.Value)
+	case OSExprLess:
+		return n < parseHex(t.Value)
+	}
+
+	return false
+}
+
+// ParseOSSubject parse the fingerprint nmap prints for a scanned host, either
+// wrapped in `OS:` lines as in nmap's output or one test per line. Lines that
+// are neither, such as `TCP/IP fingerprint:`, are skipped.
+func ParseOSSubject(s string) (*OSFingerprint, error) {
+	var sb strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "OS:"):
+			sb.WriteString(line[len("OS:"):])
+		case strings.Contains(line, "(") && strings.HasSuffix(line, ")"):
+			sb.WriteString(line)
+		}
+	}
+
+	subject := &OSFingerprint{}
+	rest := sb.String()
+	for rest != "" {
+		end := strings.IndexByte(rest, ')')
+		if end == -1 {
+			return nil, errors.WithMessagef(ErrOSDBLine, "unterminated test %q", rest)
+		}
+		test, err := parseOSTest(rest[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		subject.Tests = append(subject.Tests, test)
+		rest = rest[end+1:]
+	}
+	if len(subject.Tests) == 0 {
+		return nil, errors.WithMessage(ErrOSDBLine, "no tests in the subject fingerprint")
+	}
+
+	return subject, nil
+}
+
+// Weight returns the MatchPoints weight of an attribute of a test, 0 when
+// MatchPoints does not list it
+func (db *OSDB) Weight(test, attribute string) int {
+	return db.weights[test+"."+attribute]
+}
+
+// Compare scores a subject against a reference fingerprint the way nmap
+// does: every attribute present in both and weighted by MatchPoints adds its
+// weight to possible, and to score when the reference expression matches.
+func (db *OSDB) Compare(reference, subject *OSFingerprint) (score, possible int) {
+	for _, refTest := range reference.Tests {
+		subjectTest := subject.Test(refTest.Name)
+		if subjectTest == nil {
+			continue
+		}
+		for _, refAttr := range refTest.Attributes {
+			subjectAttr := subjectTest.Attribute(refAttr.Name)
+			weight := db.Weight(refTest.Name, refAttr.Name)
+			if subjectAttr == nil || weight == 0 {
+				continue
+			}
+			possible += weight
+			if refAttr.Expr.Match(subjectAttr.Value) {
+				score += weight
+			}
+		}
+	}
+
+	return score, possible
+}
+
+// OSGuess a reference fingerprint and how well a subject matches it
+type OSGuess struct {
+	Fingerprint *OSFingerprint `json:"fingerprint"`
+	Accuracy    float64        `json:"accuracy"`
+	Score       int            `json:"score"`
+	Possible    int            `json:"possible"`
+}
+
+// OSGuessOptions options of Guess
+type OSGuessOptions struct {
+	// MinAccuracy DefaultOSMinAccuracy when zero
+	MinAccuracy float64
+	// Limit the most guesses returned, all when zero
+	Limit int
+}
+
+// Guess compares a subject with every reference fingerprint and returns those
+// at least MinAccuracy accurate, the most accurate first
+func (db *OSDB) Guess(subject *OSFingerprint, opts OSGuessOptions) []*OSGuess {
+	if opts.MinAccuracy == 0 {
+		opts.MinAccuracy = DefaultOSMinAccuracy
+	}
+
+	var guesses []*OSGuess
+	for _, fp := range db.Fingerprints {
+		score, possible := db.Compare(fp, subject)
+		if possible == 0 {
+			continue
+		}
+		guess := &OSGuess{Fingerprint: fp, Accuracy: float64(score) / float64(possible), Score: score, Possible: possible}
+		if guess.Accuracy >= opts.MinAccuracy {
+			guesses = append(guesses, guess)
+		}
+	}
+	// file order breaks ties
+	sort.SliceStable(guesses, func(i, j int) bool {
+		return guesses[i].Accuracy > guesses[j].Accuracy
+	})
+
+	if opts.Limit > 0 && len(guesses) > opts.Limit {
+		guesses = guesses[:opts.Limit]
+	}
+
+	return guesses
+}
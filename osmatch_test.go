@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOSExprMatch(t *testing.T) {
+	expr, err := ParseOSExpr("51E80C|A3D018|>1000")
+	assert.Nil(t, err)
+	assert.True(t, expr.Match("A3D018"))
+	assert.True(t, expr.Match("1001"))
+	assert.False(t, expr.Match("1000"))
+	assert.False(t, expr.Match("Z"))
+
+	expr, _ = ParseOSExpr("FA-10A|<5")
+	assert.True(t, expr.Match("FA"))
+	assert.True(t, expr.Match("10a"))
+	assert.True(t, expr.Match("4"))
+	assert.False(t, expr.Match("10B"))
+
+	expr, _ = ParseOSExpr("")
+	assert.True(t, expr.Match(""))
+	assert.False(t, expr.Match("M5B4"))
+}
+
+// a Linux host as nmap prints it, T2 differs from the reference
+const linuxSubject = `TCP/IP fingerprint:
+OS:SCAN(V=7.94%E=4%D=10/19%OT=22%CT=1%CU=31337%PV=Y%DS=1%DC=D%G=Y%TM=6530D0A1
+OS:%P=x86_64-pc-linux-gnu)SEQ(SP=106%GCD=1%ISR=10A%TI=Z%CI=Z%II=I%TS=A)OPS(O1
+OS:=M5B4ST11NW7%O2=M5B4ST11NW7%O3=M5B4NNT11NW7%O4=M5B4ST11NW7%O5=M5B4ST11NW7%O
+OS:6=M5B4ST11)WIN(W1=FE88%W2=FE88%W3=FE88%W4=FE88%W5=FE88%W6=FE88)ECN(R=Y%DF=Y
+OS:%T=40%W=FAF0%O=M5B4NNSNW7%CC=Y%Q=)T1(R=Y%DF=Y%T=40%S=O%A=S+%F=AS%RD=0%Q=)T2
+OS:(R=Y%DF=Y%T=40%W=0%S=Z%A=S%F=AR%O=%RD=0%Q=)T3(R=N)T4(R=Y%DF=Y%T=40%W=0%S=A
+OS:%A=Z%F=R%O=%RD=0%Q=)T5(R=Y%DF=Y%T=40%W=0%S=Z%A=S+%F=AR%O=%RD=0%Q=)T6(R=Y%DF
+OS:=Y%T=40%W=0%S=A%A=Z%F=R%O=%RD=0%Q=)T7(R=Y%DF=Y%T=40%W=0%S=Z%A=S+%F=AR%O=%RD
+OS:=0%Q=)U1(R=Y%DF=N%T=40%IPL=164%UN=0%RIPL=G%RID=G%RIPCK=G%RUCK=G%RUD=G)IE(R=
+OS:Y%DFI=N%T=40%CD=S)
+`
+
+func TestOSGuess(t *testing.T) {
+	db, err := client.ParseNmapOSDB("./tests/nmap-os-db")
+	assert.Nil(t, err)
+
+	subject, err := ParseOSSubject(linuxSubject)
+	assert.Nil(t, err)
+	assert.Len(t, subject.Tests, 14)
+	assert.Equal(t, "M5B4ST11NW7", subject.Test("OPS").Attribute("O1").Value)
+
+	linux := db.Fingerprint("Linux 4.15 - 5.19")
+	score, possible := db.Compare(linux, subject)
+	// only R of T2 is compared, the reference has no other attribute
+	assert.Equal(t, possible-80, score)
+
+	guesses := db.Guess(subject, OSGuessOptions{})
+	if assert.Len(t, guesses, 1) {
+		assert.Same(t, linux, guesses[0].Fingerprint)
+		assert.InDelta(t, float64(score)/float64(possible), guesses[0].Accuracy, 1e-9)
+	}
+
+	all := db.Guess(subject, OSGuessOptions{MinAccuracy: 0.01})
+	assert.Len(t, all, 3)
+	assert.Same(t, linux, all[0].Fingerprint)
+	assert.GreaterOrEqual(t, all[1].Accuracy, all[2].Accuracy)
+	assert.Len(t, db.Guess(subject, OSGuessOptions{MinAccuracy: 0.01, Limit: 2}), 2)
+
+	_, err = ParseOSSubject("SEQ(SP=1")
+	assert.NotNil(t, err)
+}
@@ -2,15 +2,21 @@ package parser
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"reflect"
-	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/randolphcyg/cpe"
 )
 
+var (
+	ErrVInfoFieldEnd = errors.New("vInfo field end is wrong")
+	ErrMatchLine     = errors.New("match line is malformed")
+	ErrProbeLine     = errors.New("probe line is malformed")
+)
+
 type Client struct {
 }
 
@@ -21,6 +27,26 @@ type IClient interface {
 	HandleVInfo(src string) (vInfo *VInfo, err error)
 	ParseMatch(line string) (m *Match, err error)
 	ParseNmapServiceProbe(srcFilePath string) (probes []*Probe, err error)
+	ParseProbeDB(srcFilePath string) (db *ProbeDB, err error)
+	ParseProbeDBReader(r io.Reader, source string) (db *ProbeDB, err error)
+	WriteNmapServiceProbe(w io.Writer, probes []*Probe) error
+	WriteProbeDB(w io.Writer, db *ProbeDB) error
+	WriteJSON(w io.Writer, db *ProbeDB) error
+	LoadJSON(r io.Reader) (*ProbeDB, error)
+	WriteSnapshot(w io.Writer, db *ProbeDB) error
+	LoadSnapshot(r io.Reader) (*ProbeDB, error)
+	NewReloadableDB(path string, opts ReloadOptions) (*ReloadableDB, error)
+	ParseNmapServices(srcFilePath string) (*ServicesTable, error)
+	ParseNmapServicesReader(r io.Reader, source string) (*ServicesTable, error)
+	ParseNmapPayloads(srcFilePath string) (*PayloadTable, error)
+	ParseNmapPayloadsReader(r io.Reader, source string) (*PayloadTable, error)
+	ParseNmapOSDB(srcFilePath string) (*OSDB, error)
+	ParseNmapOSDBReader(r io.Reader, source string) (*OSDB, error)
+	ParseNmapMACPrefixes(srcFilePath string) (*MACPrefixTable, error)
+	ParseNmapMACPrefixesReader(r io.Reader, source string) (*MACPrefixTable, error)
+	ParseNmapRPC(srcFilePath string) (*RPCTable, error)
+	ParseNmapRPCReader(r io.Reader, source string) (*RPCTable, error)
+	LintNmapServiceProbe(srcFilePath string) ([]*LintIssue, error)
 	UnquoteRawString(rawStr string) (string, error)
 	FillVersionInfoFields(src [][]byte, match *Match) *VInfo
 	FillHelperFuncOrVariable(str string, src [][]byte) string
@@ -34,7 +60,9 @@ type IParser interface {
 	IsEmpty() bool
 }
 
-// Probe nmap service probe
+// Probe nmap service probe. Source, Line and Comment record where the probe
+// was defined and the comment block preceding it, DirectiveLines the line of
+// each directive such as ports or rarity
 type Probe struct {
 	Protocol     string   `json:"protocol"`
 	ProbeName    string   `json:"probeName"`
@@ -45,18 +73,29 @@ type Probe struct {
 	TotalWaitMs  string   `json:"totalWaitMs,omitempty"`
 	Rarity       string   `json:"rarity,omitempty"`
 	Fallback     string   `json:"fallback,omitempty"`
+	NoPayload    bool     `json:"noPayload,omitempty"`
 	Matches      []*Match `json:"matches"`
+	Source       string   `json:"source,omitempty"`
+	Line         int      `json:"line,omitempty"`
+	Comment      string   `json:"comment,omitempty"`
+
+	DirectiveLines map[string]int `json:"directiveLines,omitempty"`
 }
 
-// Match nmap service probe match rule
+// Match nmap service probe match rule, with the same source position fields as Probe
 type Match struct {
 	Pattern     string `json:"pattern"`
 	Name        string `json:"name"`
+	Soft        bool   `json:"soft,omitempty"`
 	PatternFlag string `json:"patternFlag,omitempty"`
 	VersionInfo *VInfo `json:"versionInfo,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Line        int    `json:"line,omitempty"`
+	Comment     string `json:"comment,omitempty"`
 }
 
-// VInfo version info, include six optional fields and CPE
+// VInfo version info, include six optional fields and CPE.
+// CpeFlags keeps the option letters following each CPE (the `a` of `cpe:/o:microsoft:windows/a`)
 type VInfo struct {
 	VendorProductName string     `json:"vendorProductName,omitempty"`
 	Version           string     `json:"version,omitempty"`
@@ -65,6 +104,7 @@ type VInfo struct {
 	OperatingSystem   string     `json:"operatingSystem,omitempty"`
 	DeviceType        string     `json:"deviceType,omitempty"`
 	Cpe               []*cpe.CPE `json:"cpe,omitempty"`
+	CpeFlags          []string   `json:"cpeFlags,omitempty"`
 }
 
 func (c *Client) NewProbe() *Probe {
@@ -75,6 +115,16 @@ func (x *Probe) IsEmpty() bool {
 	return reflect.DeepEqual(x, &Probe{})
 }
 
+// DirectiveLine returns the line of a directive of the probe, such as
+// `rarity`, the line of the Probe directive when it is not recorded
+func (x *Probe) DirectiveLine(name string) int {
+	if line, ok := x.DirectiveLines[name]; ok {
+		return line
+	}
+
+	return x.Line
+}
+
 func (c *Client) NewMatch() *Match {
 	return &Match{}
 }
@@ -87,125 +137,193 @@ func (v *VInfo) IsEmpty() bool {
 	return reflect.DeepEqual(v, &VInfo{})
 }
 
-func handleVInfoField(src, flagStr string) (string, string, error) {
-	if len(src) == 0 {
-		return "", "", nil
+// vInfoFields the one-letter version info fields in their canonical order
+var vInfoFields = []byte{'p', 'v', 'i', 'h', 'o', 'd'}
+
+// vInfoField returns a pointer to the version info field named by flag
+func (v *VInfo) vInfoField(flag byte) *string {
+	switch flag {
+	case 'p':
+		return &v.VendorProductName
+	case 'v':
+		return &v.Version
+	case 'i':
+		return &v.Info
+	case 'h':
+		return &v.Hostname
+	case 'o':
+		return &v.OperatingSystem
+	case 'd':
+		return &v.DeviceType
 	}
 
-	src = strings.TrimSpace(src)
-	isFlagInSrc := strings.Index(src, flagStr)
-	if isFlagInSrc == -1 {
-		return "", src, nil
+	return nil
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+func isAlnumByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// readDelimited reads `<delim>value<delim>` at the start of src, returning the
+// value and the rest of src after the closing delimiter
+func readDelimited(src string) (value, rest string, ok bool) {
+	if len(src) < 2 {
+		return "", src, false
 	}
 
-	end := strings.IndexByte(src[isFlagInSrc+len(flagStr):], '/')
+	end := strings.IndexByte(src[1:], src[0])
 	if end == -1 {
-		return "", src, errors.New("vInfo field end is wrong")
+		return "", src, false
 	}
 
-	ret := src[isFlagInSrc+len(flagStr) : isFlagInSrc+len(flagStr)+end]
-	srcRet := src[:isFlagInSrc+len(flagStr)] + src[isFlagInSrc+len(flagStr)+end+1:]
+	return src[1 : 1+end], src[1+end+1:], true
+}
+
+// readFlags reads the option letters directly following a closing delimiter
+func readFlags(src string) (flags, rest string) {
+	end := 0
+	for end < len(src) && !isSpaceByte(src[end]) {
+		end++
+	}
 
-	return ret, srcRet, nil
+	return src[:end], src[end:]
 }
 
+// HandleVInfo parse the version info part of a match line, e.g.
+// `p/vendor product/ v/$1/ cpe:/a:vendor:product:$1/`. Fields may use any
+// delimiter nmap accepts (`p|OS/2 ftpd|`), unknown words are skipped.
 func (c *Client) HandleVInfo(src string) (vInfo *VInfo, err error) {
 	vInfo = c.NewVInfo()
-	fields := []struct {
-		field string
-		set   func(string)
-	}{
-		{"p/", func(v string) { vInfo.VendorProductName = v }},
-		{"v/", func(v string) { vInfo.Version = v }},
-		{"i/", func(v string) { vInfo.Info = v }},
-		{"h/", func(v string) { vInfo.Hostname = v }},
-		{"o/", func(v string) { vInfo.OperatingSystem = v }},
-		{"d/", func(v string) { vInfo.DeviceType = v }},
-	}
 
-	for _, field := range fields {
-		fieldValue := ""
-		fieldValue, src, err = handleVInfoField(src, field.field)
-		if err != nil {
-			return
-		}
-
-		field.set(fieldValue)
-		if len(src) == 0 {
-			return
+	for src = strings.TrimSpace(src); len(src) > 0; src = strings.TrimLeft(src, " \t\r\n") {
+		switch {
+		case strings.HasPrefix(src, cpe.FlagCpe23):
+			token, rest := readFlags(src)
+			src = rest
+			cRet, errCPE := cpe.ParseCPE(token)
+			if errCPE != nil {
+				continue
+			}
+			vInfo.Cpe = append(vInfo.Cpe, cRet)
+			vInfo.CpeFlags = append(vInfo.CpeFlags, "")
+		case strings.HasPrefix(src, "cpe:") && len(src) > len("cpe:") && !isAlnumByte(src[len("cpe:")]):
+			body, rest, ok := readDelimited(src[len("cpe:"):])
+			if !ok {
+				return vInfo, ErrVInfoFieldEnd
+			}
+			flags, remain := readFlags(rest)
+			src = remain
+			cRet, errCPE := parseCPE22Body(body)
+			if errCPE != nil {
+				continue
+			}
+			vInfo.Cpe = append(vInfo.Cpe, cRet)
+			vInfo.CpeFlags = append(vInfo.CpeFlags, flags)
+		case len(src) > 1 && vInfo.vInfoField(src[0]) != nil && !isAlnumByte(src[1]) && !isSpaceByte(src[1]):
+			value, rest, ok := readDelimited(src[1:])
+			if !ok {
+				return vInfo, ErrVInfoFieldEnd
+			}
+			*vInfo.vInfoField(src[0]) = value
+			src = rest
+		default:
+			// not a version info field, skip the word
+			_, src = readFlags(src)
 		}
 	}
 
-	// CPE handle logic
-	cpeSrcStr := ""
-	isCpe22FlagInSrc := strings.Index(src, cpe.FlagCpe22)
-	if isCpe22FlagInSrc != -1 {
-		cpeSrcStr = src[isCpe22FlagInSrc : len(src)-1]
-	} else {
-		isCpe23FlagInSrc := strings.LastIndex(src, cpe.FlagCpe23)
-		if isCpe23FlagInSrc != -1 {
-			cpeSrcStr = src[isCpe23FlagInSrc : len(src)-1]
-		}
+	if !hasCpeFlags(vInfo.CpeFlags) {
+		vInfo.CpeFlags = nil
 	}
 
-	cpeSlice := strings.SplitN(cpeSrcStr, " ", -1)
-	if len(cpeSlice) > 0 {
-		for _, c := range cpeSlice {
-			cRet, err := cpe.ParseCPE(c)
-			if err != nil {
-				continue
-			}
-			vInfo.Cpe = append(vInfo.Cpe, cRet)
+	return
+}
+
+func hasCpeFlags(flags []string) bool {
+	for _, flag := range flags {
+		if flag != "" {
+			return true
 		}
 	}
 
-	return
+	return false
 }
 
+// ParseMatch parse a `match` or `softmatch` line, e.g.
+// `match ftp m|^220 ([\w.]+) FTP|s p/vendor ftpd/ v/$1/`
 func (c *Client) ParseMatch(line string) (m *Match, err error) {
 	m = c.NewMatch()
 	line = strings.TrimSpace(line)
 	line = strings.Replace(line, "\n", "", -1)
 	matchSeg := strings.SplitN(line, " ", 3)
-	name := matchSeg[1]
-	regxSeg := strings.SplitN(matchSeg[2], "|", 3)
-	pattern := regxSeg[1]
-
-	patternFlag := ""
-	versionInfo := c.NewVInfo()
-	if len(regxSeg) >= 3 {
-		versionInfoSeg := strings.SplitN(regxSeg[2], " ", 2)
-
-		if versionInfoSeg[0] != "" {
-			patternFlag = versionInfoSeg[0]
-		}
+	if len(matchSeg) < 3 || (matchSeg[0] != "match" && matchSeg[0] != "softmatch") ||
+		!strings.HasPrefix(matchSeg[2], "m") {
+		return m, ErrMatchLine
+	}
 
-		if len(versionInfoSeg) >= 2 {
-			tmp, errVInfo := c.HandleVInfo(versionInfoSeg[1])
-			if err != nil {
-				m = &Match{
-					Pattern:     pattern,
-					Name:        name,
-					PatternFlag: patternFlag,
-					VersionInfo: versionInfo,
-				}
-				return m, errVInfo
-			}
-			versionInfo = tmp
-		}
+	pattern, rest, ok := readDelimited(matchSeg[2][1:])
+	if !ok {
+		return m, ErrMatchLine
 	}
+	patternFlag, rest := readFlags(rest)
 
 	m = &Match{
 		Pattern:     pattern,
-		Name:        name,
+		Name:        matchSeg[1],
+		Soft:        matchSeg[0] == "softmatch",
 		PatternFlag: patternFlag,
-		VersionInfo: versionInfo,
+		VersionInfo: c.NewVInfo(),
 	}
 
+	versionInfo, err := c.HandleVInfo(rest)
+	if err != nil {
+		return m, err
+	}
+	m.VersionInfo = versionInfo
+
 	return
 }
 
+// parseProbeLine parse a `Probe <protocol> <name> q|<probe string>|[ no-payload]` line
+func parseProbeLine(line string, probe *Probe) error {
+	lineSeg := strings.SplitN(line, " ", 4)
+	if len(lineSeg) < 4 || !strings.HasPrefix(lineSeg[3], "q") {
+		return ErrProbeLine
+	}
+
+	probeString, rest, ok := readDelimited(lineSeg[3][1:])
+	if !ok {
+		return ErrProbeLine
+	}
+
+	probe.Protocol = lineSeg[1]
+	probe.ProbeName = lineSeg[2]
+	probe.ProbeString = probeString
+	for _, option := range strings.Fields(rest) {
+		if option == "no-payload" {
+			probe.NoPayload = true
+		}
+	}
+
+	return nil
+}
+
+// ParseNmapServiceProbe parse the nmap-service-probes file into a slice of probes
 func (c *Client) ParseNmapServiceProbe(srcFilePath string) (probes []*Probe, err error) {
+	db, err := c.ParseProbeDB(srcFilePath)
+	if err != nil {
+		return
+	}
+
+	return db.Probes, nil
+}
+
+// ParseProbeDB parse the nmap-service-probes file into an indexed probe database
+func (c *Client) ParseProbeDB(srcFilePath string) (db *ProbeDB, err error) {
 	// Open the nmap-service-probes file
 	file, err := os.Open(srcFilePath)
 	if err != nil {
@@ -213,23 +331,40 @@ func (c *Client) ParseNmapServiceProbe(srcFilePath string) (probes []*Probe, err
 	}
 	defer file.Close()
 
-	probes = make([]*Probe, 0, 200)
+	return c.ParseProbeDBReader(file, srcFilePath)
+}
+
+// ParseProbeDBReader parse probes in the nmap-service-probes format from r,
+// source names the origin recorded in the Source fields
+func (c *Client) ParseProbeDBReader(r io.Reader, source string) (db *ProbeDB, err error) {
+	probes := make([]*Probe, 0, 200)
+	var exclude []string
 
 	// Create an empty probe to hold current probe being parsed
 	currentProbe := c.NewProbe()
 
+	// comment lines preceding the current line, attached to the next probe or match
+	var comments []string
+	lineNo := 0
+
 	// Create a scanner to read the file line by line; Loop through each line of the file
-	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
 		line := scanner.Text()
-
-		// Ignore comments and empty lines
-		if strings.HasPrefix(line, "#") || len(line) == 0 || strings.HasPrefix(line, "Exclude ") {
-			continue
-		}
+		lineNo++
 
 		switch {
-		case strings.HasPrefix(line, "#"), len(line) == 0, strings.HasPrefix(line, "Exclude "):
+		case line == probeSeparator:
 			continue
+		case strings.HasPrefix(line, "#"):
+			comments = append(comments, parseCommentLine(line))
+			continue
+		case len(strings.TrimSpace(line)) == 0:
+			// a blank line detaches the comment block from what follows
+			comments = nil
+			continue
+		case strings.HasPrefix(line, "Exclude "):
+			exclude = append(exclude, strings.Split(strings.TrimSpace(line[len("Exclude "):]), ",")...)
 		case strings.HasPrefix(line, "Probe "): // If the line starts with "Probe", start a new probe
 			// If we have an existing probe, append it to the slice of probes
 			if currentProbe.ProbeName != "" {
@@ -237,56 +372,95 @@ func (c *Client) ParseNmapServiceProbe(srcFilePath string) (probes []*Probe, err
 			}
 			// Create a new probe with the name and default values
 			currentProbe = c.NewProbe()
-
-			lineSeg := strings.SplitN(line, " ", 4)
-			if lineSeg[1] != "TCP" && lineSeg[1] != "UDP" { // unsupported protocol
-				continue
+			probe := c.NewProbe()
+			if parseProbeLine(line, probe) != nil {
+				break
+			}
+			if probe.Protocol != "TCP" && probe.Protocol != "UDP" { // unsupported protocol
+				break
 			}
-			currentProbe.Protocol = lineSeg[1]
-			currentProbe.ProbeName = lineSeg[2]
-			probeStringSrc := strings.TrimPrefix(lineSeg[3], "q|")
-			probeString := strings.TrimSuffix(probeStringSrc, "|")
-			currentProbe.ProbeString = probeString
+			probe.Source, probe.Line, probe.Comment = source, lineNo, joinComment(comments)
+			currentProbe = probe
 		case strings.HasPrefix(line, "match "), strings.HasPrefix(line, "softmatch "):
 			m, err := c.ParseMatch(line)
 			if err != nil {
-				continue
+				break
 			}
+			m.Source, m.Line, m.Comment = source, lineNo, joinComment(comments)
 			currentProbe.Matches = append(currentProbe.Matches, m)
-		case strings.HasPrefix(line, "ports "):
-			currentProbe.Ports = strings.Split(line[len("ports "):], ",")
-		case strings.HasPrefix(line, "sslports "):
-			currentProbe.SslPorts = strings.Split(line[len("sslports "):], ",")
-		case strings.HasPrefix(line, "totalwaitms "):
-			currentProbe.TotalWaitMs = line[len("totalwaitms "):]
-		case strings.HasPrefix(line, "tcpwrappedms "):
-			currentProbe.TcpWrappedMs = line[len("tcpwrappedms "):]
-		case strings.HasPrefix(line, "rarity "):
-			currentProbe.Rarity = line[len("rarity "):]
-		case strings.HasPrefix(line, "fallback "):
-			currentProbe.Fallback = line[len("fallback "):]
+		default:
+			if name := parseProbeDirective(line, currentProbe); name != "" {
+				if currentProbe.DirectiveLines == nil {
+					currentProbe.DirectiveLines = make(map[string]int)
+				}
+				currentProbe.DirectiveLines[name] = lineNo
+			}
+			// comments on directives are kept with the probe
+			if comment := joinComment(comments); comment != "" {
+				if currentProbe.Comment != "" {
+					comment = currentProbe.Comment + "\n" + comment
+				}
+				currentProbe.Comment = comment
+			}
 		}
+		comments = nil
+	}
+	if err = scanner.Err(); err != nil {
+		return
 	}
 
 	// Append the last probe to the slice of probes
-	if currentProbe.IsEmpty() {
-		return
+	if !currentProbe.IsEmpty() {
+		probes = append(probes, currentProbe)
 	}
 
-	probes = append(probes, currentProbe)
+	db = NewProbeDB(probes, exclude...)
 
-	return
+	return db, nil
+}
+
+// parseProbeDirective parse the optional directives following a Probe line,
+// it returns the name of the directive or "" for unknown lines
+func parseProbeDirective(line string, probe *Probe) string {
+	switch {
+	case strings.HasPrefix(line, "ports "):
+		probe.Ports = strings.Split(line[len("ports "):], ",")
+	case strings.HasPrefix(line, "sslports "):
+		probe.SslPorts = strings.Split(line[len("sslports "):], ",")
+	case strings.HasPrefix(line, "totalwaitms "):
+		probe.TotalWaitMs = line[len("totalwaitms "):]
+	case strings.HasPrefix(line, "tcpwrappedms "):
+		probe.TcpWrappedMs = line[len("tcpwrappedms "):]
+	case strings.HasPrefix(line, "rarity "):
+		probe.Rarity = line[len("rarity "):]
+	case strings.HasPrefix(line, "fallback "):
+		probe.Fallback = line[len("fallback "):]
+	default:
+		return ""
+	}
+
+	return line[:strings.IndexByte(line, ' ')]
+}
+
+// parseCommentLine strips the `#` and the single space that usually follows it
+func parseCommentLine(line string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(line, "#"), " ")
+}
+
+// joinComment joins comment lines into a comment block
+func joinComment(lines []string) string {
+	return strings.Join(lines, "\n")
 }
 
 // UnquoteRawString raw string ==> string
 // Replaces the escape characters in the original string with the actual characters
 func (c *Client) UnquoteRawString(rawStr string) (string, error) {
-	str, err := strconv.Unquote(`"` + rawStr + `"`)
+	b, err := DecodeEscapes(rawStr)
 	if err != nil {
 		return "", err
 	}
 
-	return str, nil
+	return string(b), nil
 }
 
 // FillVersionInfoFields Replace the versionInfo and CPE placeholder elements with the matched real values
@@ -300,11 +474,14 @@ func (c *Client) FillVersionInfoFields(src [][]byte, match *Match) *VInfo {
 		OperatingSystem:   c.FillHelperFuncOrVariable(versionInfo.OperatingSystem, src),
 		DeviceType:        c.FillHelperFuncOrVariable(versionInfo.DeviceType, src),
 		Cpe:               nil,
+		CpeFlags:          versionInfo.CpeFlags,
 	}
 
 	if len(versionInfo.Cpe) > 0 {
 		for _, item := range versionInfo.Cpe {
 			tmpCPE := &cpe.CPE{
+				Part:      item.Part,
+				Edition:   c.FillHelperFuncOrVariable(item.Edition, src),
 				Version:   c.FillHelperFuncOrVariable(item.Version, src),
 				Language:  c.FillHelperFuncOrVariable(item.Language, src),
 				Vendor:    c.FillHelperFuncOrVariable(item.Vendor, src),
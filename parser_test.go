@@ -7,7 +7,6 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
-	"github.com/tealeg/xlsx"
 )
 
 var client IClient = &Client{}
@@ -87,8 +86,8 @@ func TestHelperI(t *testing.T) {
 	b := []byte{0x12, 0x34, 0x56, 0x78}
 	val1 := helperI(">", b)
 	val2 := helperI("<", b)
-	assert.Equal(t, 305419896, val1)
-	assert.Equal(t, 2018915346, val2)
+	assert.Equal(t, uint32(305419896), val1)
+	assert.Equal(t, uint32(2018915346), val2)
 }
 
 func TestFillHelperFuncOrVariable(t *testing.T) {
@@ -128,78 +127,21 @@ func TestParseMatchVInfoFieldOutOfOrder(t *testing.T) {
 	assert.Equal(t, "Windows", match.VersionInfo.OperatingSystem)
 }
 
-// TestOutToExcel output probes to excel
-func TestOutToExcel(t *testing.T) {
-	file := xlsx.NewFile()
-	sheet, err := file.AddSheet("nmap-probe-support-service")
-	if err != nil {
-		panic(err)
-	}
-
+func TestParseNmapServiceProbeSourcePositions(t *testing.T) {
 	srcFilePath := "./tests/nmap-service-probes"
 	probes, err := client.ParseNmapServiceProbe(srcFilePath)
-	if err != nil {
-		panic(err)
-	}
-
-	sheetRowHeader := sheet.AddRow()
-	sheetRowHeader.SetHeightCM(2) // 设置行高
-
-	sheetCellHeader1 := sheetRowHeader.AddCell()
-	sheetCellHeader1.Value = "服务名"
-
-	sheetCellHeader2 := sheetRowHeader.AddCell()
-	sheetCellHeader2.Value = "版本"
-
-	sheetCellHeader3 := sheetRowHeader.AddCell()
-	sheetCellHeader3.Value = "运行设备类型"
-
-	sheetCellHeader4 := sheetRowHeader.AddCell()
-	sheetCellHeader4.Value = "供应商和服务名称"
-
-	sheetCellHeader5 := sheetRowHeader.AddCell()
-	sheetCellHeader5.Value = "更多信息"
-
-	sheetCellHeader6 := sheetRowHeader.AddCell()
-	sheetCellHeader6.Value = "服务提供的主机名"
-
-	sheetCellHeader7 := sheetRowHeader.AddCell()
-	sheetCellHeader7.Value = "CPE"
-
-	for _, probe := range probes {
-		for _, service := range probe.Matches {
-
-			sheetRow := sheet.AddRow()
-			sheetRow.SetHeightCM(1) // 设置行高
-
-			sheetCell1 := sheetRow.AddCell()
-			sheetCell1.Value = service.Name
-
-			sheetCell2 := sheetRow.AddCell()
-			sheetCell2.Value = service.VersionInfo.Version
-
-			sheetCell3 := sheetRow.AddCell()
-			sheetCell3.Value = service.VersionInfo.DeviceType
-
-			sheetCell4 := sheetRow.AddCell()
-			sheetCell4.Value = service.VersionInfo.VendorProductName
-
-			sheetCell5 := sheetRow.AddCell()
-			sheetCell5.Value = service.VersionInfo.Info
-
-			sheetCell6 := sheetRow.AddCell()
-			sheetCell6.Value = service.VersionInfo.Hostname
-
-			sheetCell7 := sheetRow.AddCell()
-			marshal, _ := json.Marshal(service.VersionInfo.Cpe)
-
-			sheetCell7.Value = string(marshal)
-
-		}
-	}
-
-	err = file.Save("./tests/nmap-probe-support-service.xlsx")
-	if err != nil {
-		panic(err)
+	assert.Nil(t, err)
+
+	null := probes[0]
+	assert.Equal(t, "NULL", null.ProbeName)
+	assert.Equal(t, srcFilePath, null.Source)
+	assert.Equal(t, 33, null.Line)
+	// comments on the totalwaitms and tcpwrappedms directives stay with the probe
+	assert.Contains(t, null.Comment, "Wait for at least 6 seconds for data.")
+	assert.Contains(t, null.Comment, "probably\ntcpwrapped.")
+
+	for _, m := range null.Matches {
+		assert.Equal(t, srcFilePath, m.Source)
+		assert.NotZero(t, m.Line)
 	}
 }
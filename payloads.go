@@ -0,0 +1,180 @@
+package parser
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrPayloadEntry = errors.New("nmap-payloads entry is malformed")
+
+// Payload an entry of nmap-payloads: the bytes nmap sends to the listed
+// ports when scanning them, from SourcePort if it is not zero
+type Payload struct {
+	Protocol   string   `json:"protocol"`
+	Ports      []string `json:"ports"`
+	Data       []byte   `json:"data"`
+	SourcePort int      `json:"sourcePort,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Line       int      `json:"line,omitempty"`
+}
+
+// PayloadTable a parsed nmap-payloads file with lookups by port
+type PayloadTable struct {
+	Payloads []*Payload `json:"payloads"`
+
+	byPort map[serviceKey][]*Payload
+}
+
+// NewPayloadTable builds the port lookup of payloads in file order
+func NewPayloadTable(payloads []*Payload) *PayloadTable {
+	t := &PayloadTable{Payloads: payloads, byPort: make(map[serviceKey][]*Payload)}
+	for _, p := range payloads {
+		// the ports were checked when parsing
+		ranges, _ := parsePortSpec(p.Ports)
+		for _, r := range ranges {
+			for port := r.Low; port <= r.High; port++ {
+				key := serviceKey{protocol: p.Protocol, port: port}
+				t.byPort[key] = append(t.byPort[key], p)
+			}
+		}
+	}
+
+	return t
+}
+
+// Len returns the number of payloads
+func (t *PayloadTable) Len() int {
+	return len(t.Payloads)
+}
+
+// Lookup returns the payloads of a port in file order, nil if it has none
+func (t *PayloadTable) Lookup(protocol string, port int) []*Payload {
+	return t.byPort[serviceKey{protocol: strings.ToUpper(protocol), port: port}]
+}
+
+// ParseNmapPayloads parse an nmap-payloads file
+func (c *Client) ParseNmapPayloads(srcFilePath string) (*PayloadTable, error) {
+	file, err := os.Open(srcFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return c.ParseNmapPayloadsReader(file, srcFilePath)
+}
+
+// ParseNmapPayloadsReader parse the nmap-payloads format from r: entries are
+// `udp <ports> "payload"...` with optional `source <port>`, and may span
+// lines. Strings are decoded with DecodeEscapes like probe strings.
+func (c *Client) ParseNmapPayloadsReader(r io.Reader, source string) (*PayloadTable, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := payloadTokens(string(data))
+	if err != nil {
+		return nil, errors.WithMessage(err, source)
+	}
+
+	var payloads []*Payload
+	for i := 0; i < len(tokens); {
+		tok := tokens[i]
+		fail := func(format string, args ...interface{}) error {
+			return errors.WithMessagef(ErrPayloadEntry, "%s:%d: "+format, append([]interface{}{source, tok.line}, args...)...)
+		}
+		if tok.quoted || tok.text != "udp" && tok.text != "tcp" {
+			return nil, fail("expected a protocol, found %q", tok.text)
+		}
+		payload := &Payload{Protocol: strings.ToUpper(tok.text), Source: source, Line: tok.line}
+		i++
+
+		if i == len(tokens) || tokens[i].quoted {
+			return nil, fail("missing ports")
+		}
+		payload.Ports = strings.Split(tokens[i].text, ",")
+		if _, err = parsePortSpec(payload.Ports); err != nil {
+			return nil, fail("%v", err)
+		}
+		i++
+
+		for ; i < len(tokens) && tokens[i].quoted; i++ {
+			decoded, err := DecodeEscapes(tokens[i].text)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "%s:%d", source, tokens[i].line)
+			}
+			payload.Data = append(payload.Data, decoded...)
+		}
+		if payload.Data == nil {
+			return nil, fail("missing payload string")
+		}
+
+		if i < len(tokens) && tokens[i].text == "source" && !tokens[i].quoted {
+			if i+1 == len(tokens) || tokens[i+1].quoted {
+				return nil, fail("missing source port")
+			}
+			port, err := strconv.Atoi(tokens[i+1].text)
+			if err != nil || port < 1 || port > 65535 {
+				return nil, fail("invalid source port %q", tokens[i+1].text)
+			}
+			payload.SourcePort = port
+			i += 2
+		}
+
+		payloads = append(payloads, payload)
+	}
+
+	return NewPayloadTable(payloads), nil
+}
+
+// payloadToken a word or the raw content of a quoted string of nmap-payloads
+type payloadToken struct {
+	text   string
+	quoted bool
+	line   int
+}
+
+// payloadTokens splits nmap-payloads into words and quoted strings, skipping
+// # comments outside of strings
+func payloadTokens(s string) ([]payloadToken, error) {
+	var tokens []payloadToken
+	line := 1
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			start := i + 1
+			for i = start; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				} else if s[i] == '\n' {
+					break
+				}
+			}
+			if i >= len(s) || s[i] != '"' {
+				return nil, errors.WithMessagef(ErrPayloadEntry, "line %d: unterminated string", line)
+			}
+			tokens = append(tokens, payloadToken{text: s[start:i], quoted: true, line: line})
+			i++
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\r\n#\"", rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, payloadToken{text: s[start:i], line: line})
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNmapPayloads(t *testing.T) {
+	table, err := client.ParseNmapPayloads("./tests/nmap-payloads")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, table.Len())
+
+	generic := table.Lookup("udp", 13)
+	if assert.Len(t, generic, 1) {
+		assert.Equal(t, []byte("\r\n\r\n"), generic[0].Data)
+		assert.Equal(t, 9, generic[0].Line)
+	}
+
+	// strings on following lines are concatenated
+	ntp := table.Lookup("UDP", 123)
+	if assert.Len(t, ntp, 1) {
+		assert.Len(t, ntp[0].Data, 48)
+		assert.Equal(t, byte(0xe3), ntp[0].Data[0])
+	}
+
+	ike := table.Lookup("UDP", 500)
+	if assert.Len(t, ike, 1) {
+		assert.Equal(t, 500, ike[0].SourcePort)
+		assert.Len(t, ike[0].Data, 16)
+	}
+
+	// escaped quotes and # do not end the string, port ranges are expanded
+	snmp := table.Lookup("UDP", 1646)
+	if assert.Len(t, snmp, 1) {
+		assert.Equal(t, []byte("0\x26\x02\x01\x00\x04\x06public\xa0\x19\"#\x02"), snmp[0].Data)
+	}
+	assert.Nil(t, table.Lookup("TCP", 161))
+
+	for _, bad := range []string{`udp 53`, `udp "\x00"`, `udp 53 "\x0"`, `udp 53 "abc`, `udp 53 "a" source x`, `sctp 1 "a"`} {
+		_, err = client.ParseNmapPayloadsReader(strings.NewReader(bad), "bad")
+		assert.NotNil(t, err, bad)
+	}
+}
@@ -0,0 +1,329 @@
+package parser
+
+import (
+	"regexp/syntax"
+	"unicode/utf8"
+)
+
+// ruleLiteral a literal every match of a rule contains, found by analysing
+// its pattern. Rules without one have an empty Literal.
+type ruleLiteral struct {
+	Literal string
+	// Fold the literal is matched case-insensitively, it is then lower case
+	Fold bool
+	// Anchored the literal starts the subject
+	Anchored bool
+}
+
+// extractLiteral returns the literal prefix of an anchored pattern, else the
+// longest literal the pattern requires. Literals are in the one rune per byte
+// form of compiled patterns.
+func extractLiteral(m *Match) ruleLiteral {
+	re, err := syntax.Parse(goPattern(m), syntax.Perl)
+	if err != nil {
+		return ruleLiteral{}
+	}
+	re = re.Simplify()
+
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+
+	// ^ followed by literals
+	if len(subs) > 1 && subs[0].Op == syntax.OpBeginText {
+		if lit, ok := literalOf(subs[1]); ok {
+			return lit.anchoredAt()
+		}
+	}
+
+	var longest ruleLiteral
+	for _, sub := range subs {
+		if lit, ok := literalOf(sub); ok && len(lit.Literal) > len(longest.Literal) {
+			longest = lit
+		}
+	}
+
+	return longest
+}
+
+func (l ruleLiteral) anchoredAt() ruleLiteral {
+	l.Anchored = true
+	return l
+}
+
+// literalOf returns the literal of a literal node, possibly captured
+func literalOf(re *syntax.Regexp) (ruleLiteral, bool) {
+	if re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	if re.Op != syntax.OpLiteral {
+		return ruleLiteral{}, false
+	}
+
+	fold := re.Flags&syntax.FoldCase != 0
+	runes := make([]rune, 0, len(re.Rune))
+	for _, r := range re.Rune {
+		if fold {
+			// only ASCII letters fold the same way in the pattern and the subject
+			if r >= utf8.RuneSelf {
+				return ruleLiteral{}, false
+			}
+			r = rune(lowerASCII(byte(r)))
+		}
+		runes = append(runes, r)
+	}
+
+	return ruleLiteral{Literal: string(runes), Fold: fold}, true
+}
+
+func lowerASCII(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+
+	return b
+}
+
+// prefilter returns the prefilter of a probe, building it on first use and
+// again when the rules of the probe were added, removed or replaced since
+func (db *ProbeDB) prefilter(p *Probe) *probePrefilter {
+	if cached, ok := db.prefilters.Load(p); ok && cached.(*probePrefilter).builtFrom(p.Matches) {
+		return cached.(*probePrefilter)
+	}
+
+	literals := make([]ruleLiteral, len(p.Matches))
+	for i, m := range p.Matches {
+		literals[i] = extractLiteral(m)
+	}
+	f := newProbePrefilter(literals)
+	f.matches = append([]*Match(nil), p.Matches...)
+	db.prefilters.Store(p, f)
+
+	return f
+}
+
+// probePrefilter narrows the rules of a probe down to those whose literal
+// occurs in a response, so only they run their pattern
+type probePrefilter struct {
+	rules  int
+	always []int
+	exact  *ahoCorasick
+	folded *ahoCorasick
+	// matches the rules the prefilter was built from
+	matches []*Match
+}
+
+// builtFrom reports whether the prefilter was built from these rules
+func (f *probePrefilter) builtFrom(matches []*Match) bool {
+	if len(f.matches) != len(matches) {
+		return false
+	}
+	for i, m := range matches {
+		if f.matches[i] != m {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newProbePrefilter(literals []ruleLiteral) *probePrefilter {
+	f := &probePrefilter{rules: len(literals), exact: newAhoCorasick(), folded: newAhoCorasick()}
+	for i, lit := range literals {
+		switch {
+		case lit.Literal == "":
+			f.always = append(f.always, i)
+		case lit.Fold:
+			f.folded.add(lit.Literal, i, lit.Anchored)
+		default:
+			f.exact.add(lit.Literal, i, lit.Anchored)
+		}
+	}
+	f.exact.build()
+	f.folded.build()
+
+	return f
+}
+
+// candidates reports for every rule whether it may match the subject, a
+// response in the one rune per byte form
+func (f *probePrefilter) candidates(subject string) []bool {
+	candidates := make([]bool, f.rules)
+	for _, i := range f.always {
+		candidates[i] = true
+	}
+	mark := func(rule int) {
+		candidates[rule] = true
+	}
+	f.exact.scan(subject, mark)
+
+	if len(f.folded.keys) > 0 {
+		lower := []byte(subject)
+		for i := range lower {
+			lower[i] = lowerASCII(lower[i])
+		}
+		f.folded.scan(string(lower), mark)
+	}
+
+	return candidates
+}
+
+// acNode a state of the automaton: its transitions are edges[edges:edgesEnd]
+// and the keys ending here keyIndex[out:outEnd] of the automaton. dict is the
+// nearest state on the failure path with keys, -1 if there is none.
+type acNode struct {
+	edges, edgesEnd int32
+	out, outEnd     int32
+	fail            int32
+	dict            int32
+}
+
+// acEdge a transition to the state next on byte b
+type acEdge struct {
+	b    byte
+	next int32
+}
+
+// acKey a literal added to the automaton and the rule it stands for
+type acKey struct {
+	length   int
+	rule     int
+	anchored bool
+}
+
+// ahoCorasick an Aho-Corasick automaton finding every key in a single pass.
+// Most states have a handful of transitions, so they are kept in one flat
+// array, only the root has a lookup table. While keys are added the
+// transitions and outputs live in pending and are flattened by build.
+type ahoCorasick struct {
+	nodes    []acNode
+	edges    []acEdge
+	keyIndex []int32
+	keys     []acKey
+	root     [256]int32
+	pending  *acPending
+}
+
+// acPending the transitions and outputs of every state before build
+type acPending struct {
+	edges [][]acEdge
+	out   [][]int32
+}
+
+func newAhoCorasick() *ahoCorasick {
+	return &ahoCorasick{nodes: []acNode{{dict: -1}}, pending: &acPending{edges: make([][]acEdge, 1), out: make([][]int32, 1)}}
+}
+
+// next returns the transition of a state on b, 0 if there is none
+func (a *ahoCorasick) next(state int32, b byte) int32 {
+	if state == 0 {
+		return a.root[b]
+	}
+	node := &a.nodes[state]
+	for _, e := range a.edges[node.edges:node.edgesEnd] {
+		if e.b == b {
+			return e.next
+		}
+	}
+
+	return 0
+}
+
+// output returns the keys ending in a state
+func (a *ahoCorasick) output(state int32) []int32 {
+	return a.keyIndex[a.nodes[state].out:a.nodes[state].outEnd]
+}
+
+func (a *ahoCorasick) add(key string, rule int, anchored bool) {
+	p := a.pending
+	state := int32(0)
+	for i := 0; i < len(key); i++ {
+		next := int32(0)
+		for _, e := range p.edges[state] {
+			if e.b == key[i] {
+				next = e.next
+			}
+		}
+		if next == 0 {
+			next = int32(len(a.nodes))
+			a.nodes = append(a.nodes, acNode{dict: -1})
+			p.edges = append(p.edges, nil)
+			p.out = append(p.out, nil)
+			p.edges[state] = append(p.edges[state], acEdge{b: key[i], next: next})
+		}
+		state = next
+	}
+	p.out[state] = append(p.out[state], int32(len(a.keys)))
+	a.keys = append(a.keys, acKey{length: len(key), rule: rule, anchored: anchored})
+}
+
+// build flattens the transitions and outputs, then computes the failure and
+// dictionary links breadth first
+func (a *ahoCorasick) build() {
+	a.edges = make([]acEdge, 0, len(a.nodes)-1)
+	a.keyIndex = make([]int32, 0, len(a.keys))
+	for i := range a.nodes {
+		node := &a.nodes[i]
+		node.edges = int32(len(a.edges))
+		a.edges = append(a.edges, a.pending.edges[i]...)
+		node.edgesEnd = int32(len(a.edges))
+		node.out = int32(len(a.keyIndex))
+		a.keyIndex = append(a.keyIndex, a.pending.out[i]...)
+		node.outEnd = int32(len(a.keyIndex))
+	}
+	a.pending = nil
+	for _, e := range a.edges[a.nodes[0].edges:a.nodes[0].edgesEnd] {
+		a.root[e.b] = e.next
+	}
+
+	queue := make([]int32, 0, len(a.nodes))
+	queue = append(queue, 0)
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, e := range a.edges[a.nodes[state].edges:a.nodes[state].edgesEnd] {
+			child := e.next
+			queue = append(queue, child)
+			if state == 0 {
+				continue
+			}
+
+			fail := a.nodes[state].fail
+			for fail != 0 && a.next(fail, e.b) == 0 {
+				fail = a.nodes[fail].fail
+			}
+			a.nodes[child].fail = a.next(fail, e.b)
+
+			fail = a.nodes[child].fail
+			if len(a.output(fail)) > 0 {
+				a.nodes[child].dict = fail
+			} else {
+				a.nodes[child].dict = a.nodes[fail].dict
+			}
+		}
+	}
+}
+
+// scan calls found with the rule of every key occurring in s, anchored keys
+// only when they start s
+func (a *ahoCorasick) scan(s string, found func(rule int)) {
+	state := int32(0)
+	for i := 0; i < len(s); i++ {
+		next := a.next(state, s[i])
+		for next == 0 && state != 0 {
+			state = a.nodes[state].fail
+			next = a.next(state, s[i])
+		}
+		state = next
+
+		for hit := state; hit > 0; hit = a.nodes[hit].dict {
+			for _, k := range a.output(hit) {
+				key := a.keys[k]
+				if !key.anchored || key.length == i+1 {
+					found(key.rule)
+				}
+			}
+		}
+	}
+}
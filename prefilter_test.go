@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var prefilterBanners = [][]byte{
+	[]byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1\r\n"),
+	[]byte("220 ProFTPD 1.3.5 Server (Debian) [::ffff:10.0.0.1]\r\n"),
+	[]byte("HTTP/1.1 200 OK\r\nServer: nginx/1.18.0\r\nContent-Length: 0\r\n\r\n"),
+	[]byte("\xc4\x00\x00\x00\x0a5.7.42\x00"),
+	[]byte("+OK Dovecot ready.\r\n"),
+	[]byte("\x00\x01 nothing known"),
+}
+
+func TestExtractLiteral(t *testing.T) {
+	cases := []struct {
+		pattern string
+		flags   string
+		want    ruleLiteral
+	}{
+		{`^SSH-([\d.]+)-OpenSSH`, "", ruleLiteral{Literal: "SSH-", Anchored: true}},
+		{`^220 .*FTP server ready`, "", ruleLiteral{Literal: "220 ", Anchored: true}},
+		{`^\d+ .*Server: Apache`, "s", ruleLiteral{Literal: "Server: Apache"}},
+		{`^HTTP/1\.0 200`, "i", ruleLiteral{Literal: "http/1.0 200", Fold: true, Anchored: true}},
+		{`^foo|^bar`, "", ruleLiteral{}},
+		{`^(?!x)abc`, "", ruleLiteral{}},
+		{`^\xff\xfb`, "", ruleLiteral{Literal: latin1String([]byte{0xff, 0xfb}), Anchored: true}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, extractLiteral(&Match{Pattern: c.pattern, PatternFlag: c.flags}), c.pattern)
+	}
+}
+
+func TestPrefilterSameResult(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+
+	for _, name := range []string{"NULL", "GetRequest"} {
+		p := db.Probe("TCP", name)
+		subjects := append([][]byte{}, prefilterBanners...)
+		for i := 0; i < len(p.Matches); i += 5 {
+			for _, sample := range generateSamples(p.Matches[i], 2) {
+				subjects = append(subjects, latin1Bytes(sample))
+			}
+		}
+
+		for _, subject := range subjects {
+			want := db.matchResponse(p, subject, false)
+			got := db.matchResponse(p, subject, true)
+			if want == nil {
+				assert.Nil(t, got, "%q", subject)
+				continue
+			}
+			if assert.NotNil(t, got, "%q", subject) {
+				assert.Equal(t, want.Match, got.Match, "%q", subject)
+				assert.Equal(t, want.Probe, got.Probe, "%q", subject)
+			}
+		}
+	}
+}
+
+func TestPrefilterReplacedRule(t *testing.T) {
+	db, err := client.ParseProbeDBReader(strings.NewReader("Probe TCP NULL q||\nmatch ftp m|^220 FTP|\n"), "prefilter")
+	assert.Nil(t, err)
+	p := db.Probe("TCP", "NULL")
+	assert.NotNil(t, db.MatchResponse(p, []byte("220 FTP\r\n")))
+
+	// replacing a rule keeps the count of rules but rebuilds the prefilter
+	m, err := client.ParseMatch("match ssh m|^SSH-|")
+	assert.Nil(t, err)
+	p.Matches[0] = m
+	result := db.MatchResponse(p, []byte("SSH-2.0-OpenSSH_9.6\r\n"))
+	if assert.NotNil(t, result) {
+		assert.Equal(t, "ssh", result.Service)
+	}
+}
+
+func benchmarkMatchResponse(b *testing.B, prefilter bool) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	if err != nil {
+		b.Fatal(err)
+	}
+	null := db.Probe("TCP", "NULL")
+	// compile every pattern and build the prefilter before timing
+	for _, banner := range prefilterBanners {
+		db.matchResponse(null, banner, prefilter)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.matchResponse(null, prefilterBanners[i%len(prefilterBanners)], prefilter)
+	}
+}
+
+func BenchmarkMatchResponsePrefilter(b *testing.B) {
+	benchmarkMatchResponse(b, true)
+}
+
+func BenchmarkMatchResponseInOrder(b *testing.B) {
+	benchmarkMatchResponse(b, false)
+}
@@ -0,0 +1,293 @@
+package parser
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var ErrPortSpec = errors.New("invalid port specification")
+
+// Rule a match rule together with the probe it belongs to
+type Rule struct {
+	Probe *Probe
+	Match *Match
+}
+
+// portRange an inclusive port range, Protocol is empty when it applies to every protocol
+type portRange struct {
+	Protocol string
+	Low      int
+	High     int
+}
+
+func (r portRange) contains(protocol string, port int) bool {
+	return (r.Protocol == "" || r.Protocol == protocol) && r.Low <= port && port <= r.High
+}
+
+// parsePortSpec parse a port list such as `1,7,9-13` or `T:9100-9107,U:53`.
+// As with nmap's -p option a protocol prefix applies to the ports following it.
+func parsePortSpec(items []string) (ranges []portRange, err error) {
+	protocol := ""
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		switch {
+		case strings.HasPrefix(item, "T:"):
+			protocol, item = "TCP", item[2:]
+		case strings.HasPrefix(item, "U:"):
+			protocol, item = "UDP", item[2:]
+		}
+		if item == "" {
+			continue
+		}
+
+		low, high := item, item
+		if i := strings.IndexByte(item, '-'); i != -1 {
+			low, high = item[:i], item[i+1:]
+		}
+
+		r := portRange{Protocol: protocol}
+		r.Low, err = strconv.Atoi(low)
+		if err != nil {
+			return nil, errors.WithMessage(ErrPortSpec, item)
+		}
+		r.High, err = strconv.Atoi(high)
+		if err != nil {
+			return nil, errors.WithMessage(ErrPortSpec, item)
+		}
+		if r.Low < 0 || r.High > 65535 || r.Low > r.High {
+			return nil, errors.WithMessage(ErrPortSpec, item)
+		}
+		ranges = append(ranges, r)
+	}
+
+	return ranges, nil
+}
+
+// ProbeDB a parsed nmap-service-probes database with lookups by probe name,
+// protocol, port and service name. Probes and their matches keep file order.
+type ProbeDB struct {
+	Probes  []*Probe `json:"probes"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	byName     map[string][]*Probe
+	byProtocol map[string][]*Probe
+	byService  map[string][]*Rule
+	byPort     map[int][]*Probe
+	portRanges map[*Probe][]portRange
+	// rangeProbes the probes of each protocol with port ranges, in file order
+	rangeProbes map[string][]*Probe
+	// order the position of every probe in Probes
+	order    map[*Probe]int
+	excluded []portRange
+	// compiled caches the compiled pattern of every rule tried, see matcher.go
+	compiled sync.Map
+	// prefilters caches the prefilter of every probe matched, see prefilter.go
+	prefilters sync.Map
+	// templates caches the parsed version info templates of every rule matched, see template.go
+	templates sync.Map
+}
+
+// NewProbeDB builds a probe database and its indexes from probes in priority
+// order and the port list of the Exclude directive
+func NewProbeDB(probes []*Probe, exclude ...string) *ProbeDB {
+	db := &ProbeDB{
+		Probes:      probes,
+		Exclude:     exclude,
+		byName:      make(map[string][]*Probe),
+		byProtocol:  make(map[string][]*Probe),
+		byService:   make(map[string][]*Rule),
+		byPort:      make(map[int][]*Probe),
+		portRanges:  make(map[*Probe][]portRange),
+		rangeProbes: make(map[string][]*Probe),
+		order:       make(map[*Probe]int, len(probes)),
+	}
+	// a malformed Exclude directive is reported by the linter and excludes nothing
+	db.excluded, _ = parsePortSpec(exclude)
+
+	for i, p := range probes {
+		db.order[p] = i
+		db.byName[p.ProbeName] = append(db.byName[p.ProbeName], p)
+		db.byProtocol[p.Protocol] = append(db.byProtocol[p.Protocol], p)
+		for _, m := range p.Matches {
+			db.byService[m.Name] = append(db.byService[m.Name], &Rule{Probe: p, Match: m})
+		}
+
+		// malformed port lists are reported by the linter, here they are skipped
+		ranges, _ := parsePortSpec(append(append([]string{}, p.Ports...), p.SslPorts...))
+		for _, r := range ranges {
+			if r.Low == r.High {
+				if !containsProbe(db.byPort[r.Low], p) {
+					db.byPort[r.Low] = append(db.byPort[r.Low], p)
+				}
+				continue
+			}
+			if len(db.portRanges[p]) == 0 {
+				db.rangeProbes[p.Protocol] = append(db.rangeProbes[p.Protocol], p)
+			}
+			db.portRanges[p] = append(db.portRanges[p], r)
+		}
+	}
+
+	return db
+}
+
+func containsProbe(probes []*Probe, p *Probe) bool {
+	for _, item := range probes {
+		if item == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Len returns the number of probes
+func (db *ProbeDB) Len() int {
+	return len(db.Probes)
+}
+
+// Probe returns the probe with the given protocol and name, nil if there is none
+func (db *ProbeDB) Probe(protocol, name string) *Probe {
+	for _, p := range db.byName[name] {
+		if p.Protocol == protocol {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// ProbesByName returns the probes of every protocol with the given name
+func (db *ProbeDB) ProbesByName(name string) []*Probe {
+	return db.byName[name]
+}
+
+// ProbesByProtocol returns the TCP or UDP probes
+func (db *ProbeDB) ProbesByProtocol(protocol string) []*Probe {
+	return db.byProtocol[protocol]
+}
+
+// ProbesForPort returns the probes of the protocol whose ports or sslports
+// directive lists port, in file order
+func (db *ProbeDB) ProbesForPort(protocol string, port int) []*Probe {
+	var probes []*Probe
+	for _, p := range db.byPort[port] {
+		if p.Protocol == protocol {
+			probes = append(probes, p)
+		}
+	}
+	listed := len(probes)
+	for _, p := range db.rangeProbes[protocol] {
+		if db.inPortRanges(p, port) && !containsProbe(probes[:listed], p) {
+			probes = append(probes, p)
+		}
+	}
+	if listed < len(probes) {
+		sort.SliceStable(probes, func(i, j int) bool { return db.order[probes[i]] < db.order[probes[j]] })
+	}
+
+	return probes
+}
+
+func (db *ProbeDB) probeHasPort(p *Probe, port int) bool {
+	return containsProbe(db.byPort[port], p) || db.inPortRanges(p, port)
+}
+
+// inPortRanges reports whether a port range of the probe holds the port
+func (db *ProbeDB) inPortRanges(p *Probe, port int) bool {
+	for _, r := range db.portRanges[p] {
+		if r.contains(p.Protocol, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RulesByService returns every match rule identifying the service, in file order
+func (db *ProbeDB) RulesByService(service string) []*Rule {
+	return db.byService[service]
+}
+
+// Services returns the sorted names of all services the database can identify
+func (db *ProbeDB) Services() []string {
+	services := make([]string, 0, len(db.byService))
+	for service := range db.byService {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	return services
+}
+
+// IsExcluded reports whether the Exclude directive skips the port
+func (db *ProbeDB) IsExcluded(protocol string, port int) bool {
+	for _, r := range db.excluded {
+		if r.contains(protocol, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Each calls fn for every probe in order until fn returns false
+func (db *ProbeDB) Each(fn func(p *Probe) bool) {
+	for _, p := range db.Probes {
+		if !fn(p) {
+			return
+		}
+	}
+}
+
+// EachMatch calls fn for every match rule of every probe in order until fn returns false
+func (db *ProbeDB) EachMatch(fn func(p *Probe, m *Match) bool) {
+	for _, p := range db.Probes {
+		for _, m := range p.Matches {
+			if !fn(p, m) {
+				return
+			}
+		}
+	}
+}
+
+// ProbeFilter selects probes and rules, empty fields select everything
+type ProbeFilter struct {
+	Protocols  []string
+	ProbeNames []string
+	Services   []string
+}
+
+// Filter returns a database holding the probes of the filter's protocols and
+// names and, when services are given, only the rules identifying them.
+// Probes left without rules are dropped then. The probes of db are not modified.
+func (db *ProbeDB) Filter(f ProbeFilter) *ProbeDB {
+	var probes []*Probe
+	for _, p := range db.Probes {
+		if len(f.Protocols) > 0 && !containsString(f.Protocols, p.Protocol) ||
+			len(f.ProbeNames) > 0 && !containsString(f.ProbeNames, p.ProbeName) {
+			continue
+		}
+		if len(f.Services) == 0 {
+			probes = append(probes, p)
+			continue
+		}
+
+		cp := copyProbe(p)
+		cp.Matches = cp.Matches[:0]
+		for _, m := range p.Matches {
+			if containsString(f.Services, m.Name) {
+				cp.Matches = append(cp.Matches, m)
+			}
+		}
+		if len(cp.Matches) > 0 {
+			probes = append(probes, cp)
+		}
+	}
+
+	return NewProbeDB(probes, db.Exclude...)
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeDB(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"T:9100-9107"}, db.Exclude)
+
+	null := db.Probe("TCP", "NULL")
+	assert.NotNil(t, null)
+	assert.Equal(t, db.Probes[0], null)
+	assert.Nil(t, db.Probe("UDP", "NULL"))
+	assert.Equal(t, 2, len(db.ProbesByName("Help")))
+
+	for _, p := range db.ProbesByProtocol("UDP") {
+		assert.Equal(t, "UDP", p.Protocol)
+	}
+
+	probes := db.ProbesForPort("TCP", 80)
+	assert.Contains(t, probes, db.Probe("TCP", "GetRequest"))
+	for _, p := range probes {
+		assert.True(t, db.probeHasPort(p, 80))
+	}
+
+	rules := db.RulesByService("mysql")
+	assert.NotEmpty(t, rules)
+	for _, rule := range rules {
+		assert.Equal(t, "mysql", rule.Match.Name)
+		assert.Contains(t, rule.Probe.Matches, rule.Match)
+	}
+	assert.Contains(t, db.Services(), "mysql")
+
+	assert.True(t, db.IsExcluded("TCP", 9100))
+	assert.False(t, db.IsExcluded("UDP", 9100))
+
+	count := 0
+	db.EachMatch(func(p *Probe, m *Match) bool {
+		count++
+		return true
+	})
+	assert.Equal(t, 11917, count)
+}
+
+func TestProbeDBFilter(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+
+	udp := db.Filter(ProbeFilter{Protocols: []string{"UDP"}})
+	assert.Equal(t, len(db.ProbesByProtocol("UDP")), udp.Len())
+
+	mysql := db.Filter(ProbeFilter{ProbeNames: []string{"NULL", "GetRequest"}, Services: []string{"mysql"}})
+	assert.Equal(t, 1, mysql.Len())
+	assert.Equal(t, "NULL", mysql.Probes[0].ProbeName)
+	for _, m := range mysql.Probes[0].Matches {
+		assert.Equal(t, "mysql", m.Name)
+	}
+	assert.Greater(t, len(db.Probe("TCP", "NULL").Matches), len(mysql.Probes[0].Matches))
+}
+
+func TestProbesForPortOrder(t *testing.T) {
+	src := "Exclude T:9100-9107,U:53\n\nProbe TCP A q||\nports 1-100\n\nProbe TCP B q||\nports 80\n\n" +
+		"Probe UDP C q||\nports 80\n\nProbe TCP D q||\nports 70-90,80\n\nProbe TCP E q||\nsslports 80\n"
+	db, err := client.ParseProbeDBReader(strings.NewReader(src), "order")
+	assert.Nil(t, err)
+
+	// single ports and ranges are merged in file order, each probe once
+	var names []string
+	for _, p := range db.ProbesForPort("TCP", 80) {
+		names = append(names, p.ProbeName)
+	}
+	assert.Equal(t, []string{"A", "B", "D", "E"}, names)
+	assert.Len(t, db.ProbesForPort("TCP", 95), 1)
+	assert.Empty(t, db.ProbesForPort("TCP", 200))
+
+	// the Exclude directive is kept by the databases built from this one
+	for _, d := range []*ProbeDB{db, db.Filter(ProbeFilter{Protocols: []string{"TCP"}})} {
+		assert.True(t, d.IsExcluded("TCP", 9105))
+		assert.True(t, d.IsExcluded("UDP", 53))
+		assert.False(t, d.IsExcluded("TCP", 53))
+	}
+}
+
+func TestWriteProbeDB(t *testing.T) {
+	src := "Exclude T:9100-9107\n\nProbe TCP NULL q||\ntotalwaitms 6000\n\nmatch ftp m|^220 FTP\\r\\n|\n"
+	db, err := client.ParseProbeDBReader(strings.NewReader(src), "custom-probes")
+	assert.Nil(t, err)
+	assert.Equal(t, "custom-probes", db.Probes[0].Source)
+
+	var sb strings.Builder
+	assert.Nil(t, client.WriteProbeDB(&sb, db))
+	assert.True(t, strings.HasPrefix(sb.String(), "Exclude T:9100-9107\n"))
+
+	reparsed, err := client.ParseProbeDBReader(strings.NewReader(sb.String()), "custom-probes")
+	assert.Nil(t, err)
+	assert.Equal(t, db.Exclude, reparsed.Exclude)
+	assert.Equal(t, clearSourcePositions(db.Probes), clearSourcePositions(reparsed.Probes))
+}
+
+func TestParsePortSpec(t *testing.T) {
+	ranges, err := parsePortSpec([]string{"1", "7-9", "U:53"})
+	assert.Nil(t, err)
+	assert.Equal(t, []portRange{{"", 1, 1}, {"", 7, 9}, {"UDP", 53, 53}}, ranges)
+
+	_, err = parsePortSpec([]string{"70000"})
+	assert.ErrorIs(t, err, ErrPortSpec)
+}
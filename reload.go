@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultReloadInterval how often a ReloadableDB checks its file by default
+const DefaultReloadInterval = 30 * time.Second
+
+var ErrReloadValidation = errors.New("probe file failed validation")
+
+// ReloadOptions options of a ReloadableDB
+type ReloadOptions struct {
+	// Interval how often the file is checked, DefaultReloadInterval when zero
+	Interval time.Duration
+	// Lenient accepts files with lint warnings, such as patterns Go cannot
+	// compile. Lint errors are always rejected, warnings are unless Lenient.
+	Lenient bool
+	// OnReload is called with every database swapped in after the first
+	OnReload func(db *ProbeDB)
+	// OnError is called when a changed file cannot be read, parsed or
+	// validated, the previous database stays active then
+	OnError func(err error)
+}
+
+// ReloadableDB a probe database that follows changes of its file. The file
+// is polled for a new modification time or size, then reparsed in the
+// background when its SHA-256 changed, validated strictly with the linter and
+// swapped in atomically. Callers take the database with Current once per detection,
+// so detections in flight finish on the database they started with.
+type ReloadableDB struct {
+	client  *Client
+	path    string
+	opts    ReloadOptions
+	current atomic.Pointer[ProbeDB]
+
+	// mu serializes checks of the file and guards the fields below
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReloadableDB loads and validates a probe file and starts watching it.
+// The first load has to succeed. Close stops watching.
+func (c *Client) NewReloadableDB(path string, opts ReloadOptions) (*ReloadableDB, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultReloadInterval
+	}
+
+	r := &ReloadableDB{client: c, path: path, opts: opts, stop: make(chan struct{}), done: make(chan struct{})}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	go r.watch()
+
+	return r, nil
+}
+
+// Current returns the active database
+func (r *ReloadableDB) Current() *ProbeDB {
+	return r.current.Load()
+}
+
+// Detector returns a detector over the active database, it keeps using that
+// database after later reloads
+func (r *ReloadableDB) Detector(opts DetectOptions) *Detector {
+	return NewDetector(r.Current(), opts)
+}
+
+// Reload checks the file now and swaps in its database when the content
+// changed. It reports whether a new database became active.
+func (r *ReloadableDB) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	if r.Current() != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	// a rejected content is remembered too, so it is reported once
+	r.modTime, r.size = info.ModTime(), info.Size()
+	hash := sha256.Sum256(data)
+	if r.Current() != nil && hash == r.hash {
+		return false, nil
+	}
+	r.hash = hash
+
+	db, err := r.load(data)
+	if err != nil {
+		return false, err
+	}
+	r.current.Store(db)
+
+	return true, nil
+}
+
+// load parses and validates the content of the file
+func (r *ReloadableDB) load(data []byte) (*ProbeDB, error) {
+	issues, db, err := r.client.lintProbeData(data, r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rejected []*LintIssue
+	for _, issue := range issues {
+		if issue.Severity == LintError || !r.opts.Lenient {
+			rejected = append(rejected, issue)
+		}
+	}
+	if len(rejected) > 0 {
+		return nil, errors.WithMessagef(ErrReloadValidation, "%d issues, the first %s", len(rejected), rejected[0])
+	}
+
+	return db, nil
+}
+
+func (r *ReloadableDB) watch() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.Reload()
+		switch {
+		case err != nil && r.opts.OnError != nil:
+			r.opts.OnError(err)
+		case reloaded && r.opts.OnReload != nil:
+			r.opts.OnReload(r.Current())
+		}
+	}
+}
+
+// Close stops watching the file, the active database stays usable
+func (r *ReloadableDB) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadableDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nmap-service-probes")
+	modTime := time.Now()
+	write := func(content string) {
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+		// every write gets a new mtime even on file systems with a coarse one
+		modTime = modTime.Add(time.Second)
+		assert.Nil(t, os.Chtimes(path, modTime, modTime))
+	}
+	write("Probe TCP NULL q||\nmatch ftp m|^220 FTP|\n")
+
+	reloads := make(chan *ProbeDB, 1)
+	errs := make(chan error, 1)
+	r, err := client.NewReloadableDB(path, ReloadOptions{
+		Interval: 10 * time.Millisecond,
+		OnReload: func(db *ProbeDB) { reloads <- db },
+		OnError:  func(err error) { errs <- err },
+	})
+	assert.Nil(t, err)
+	defer r.Close()
+
+	old := r.Current()
+	assert.Len(t, old.Probe("TCP", "NULL").Matches, 1)
+
+	write("Probe TCP NULL q||\nmatch ftp m|^220 FTP|\nmatch ssh m|^SSH-|\n")
+	select {
+	case db := <-reloads:
+		assert.Len(t, db.Probe("TCP", "NULL").Matches, 2)
+		assert.Same(t, db, r.Current())
+		// the old database is left as it was
+		assert.Len(t, old.Probe("TCP", "NULL").Matches, 1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload")
+	}
+
+	active := r.Current()
+	write("Probe TCP NULL q||\nfallback Missing\nmatch ftp m|^220 FTP|\n")
+	select {
+	case err = <-errs:
+		assert.ErrorIs(t, err, ErrReloadValidation)
+		assert.Same(t, active, r.Current())
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error reported")
+	}
+}
+
+func TestReloadableDBStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nmap-service-probes")
+	// a pattern Go cannot compile is a lint warning
+	assert.Nil(t, os.WriteFile(path, []byte("Probe TCP NULL q||\nmatch ftp m|^(?=220)|\n"), 0644))
+
+	_, err := client.NewReloadableDB(path, ReloadOptions{Interval: time.Hour})
+	assert.ErrorIs(t, err, ErrReloadValidation)
+
+	r, err := client.NewReloadableDB(path, ReloadOptions{Interval: time.Hour, Lenient: true})
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+}
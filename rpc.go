@@ -0,0 +1,325 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrRPCLine = errors.New("nmap-rpc line is malformed")
+
+// RPCProgram a line of nmap-rpc: an ONC RPC program and its aliases
+type RPCProgram struct {
+	Name    string   `json:"name"`
+	Number  uint32   `json:"number"`
+	Aliases []string `json:"aliases,omitempty"`
+	Line    int      `json:"line,omitempty"`
+}
+
+// RPCTable a parsed nmap-rpc file with lookups by program number and name
+type RPCTable struct {
+	Programs []*RPCProgram `json:"programs"`
+
+	byNumber map[uint32]*RPCProgram
+	byName   map[string]*RPCProgram
+}
+
+// NewRPCTable builds the lookups of programs, the first of duplicates wins
+func NewRPCTable(programs []*RPCProgram) *RPCTable {
+	t := &RPCTable{Programs: programs, byNumber: make(map[uint32]*RPCProgram), byName: make(map[string]*RPCProgram)}
+	for _, p := range programs {
+		if _, ok := t.byNumber[p.Number]; !ok {
+			t.byNumber[p.Number] = p
+		}
+		for _, name := range append([]string{p.Name}, p.Aliases...) {
+			if _, ok := t.byName[name]; !ok {
+				t.byName[name] = p
+			}
+		}
+	}
+
+	return t
+}
+
+// ParseNmapRPC parse an nmap-rpc file
+func (c *Client) ParseNmapRPC(srcFilePath string) (*RPCTable, error) {
+	file, err := os.Open(srcFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return c.ParseNmapRPCReader(file, srcFilePath)
+}
+
+// ParseNmapRPCReader parse the nmap-rpc format from r, source names the
+// origin reported in errors
+func (c *Client) ParseNmapRPCReader(r io.Reader, source string) (*RPCTable, error) {
+	var programs []*RPCProgram
+	lineNo := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 2 {
+			return nil, errors.WithMessagef(ErrRPCLine, "%s:%d: %s", source, lineNo, line)
+		}
+		number, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, errors.WithMessagef(ErrRPCLine, "%s:%d: %s", source, lineNo, line)
+		}
+		programs = append(programs, &RPCProgram{Name: fields[0], Number: uint32(number), Aliases: fields[2:], Line: lineNo})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewRPCTable(programs), nil
+}
+
+// Lookup returns the program with the given number, nil if it is not listed
+func (t *RPCTable) Lookup(number uint32) *RPCProgram {
+	return t.byNumber[number]
+}
+
+// ByName returns the program with the given name or alias, nil if it is not listed
+func (t *RPCTable) ByName(name string) *RPCProgram {
+	return t.byName[name]
+}
+
+// ProgramName returns the name of a program number, empty when it is not listed
+func (t *RPCTable) ProgramName(number uint32) string {
+	if p := t.Lookup(number); p != nil {
+		return p.Name
+	}
+
+	return ""
+}
+
+// RPCInfo the ONC RPC program answering on a port and the versions it
+// supports, as nmap's RPC grinding reports it next to rpcbind detections
+type RPCInfo struct {
+	Program     uint32 `json:"program"`
+	Name        string `json:"name,omitempty"`
+	LowVersion  uint32 `json:"lowVersion"`
+	HighVersion uint32 `json:"highVersion"`
+}
+
+// String renders the info like nmap does, such as `2-4 (RPC #100000)`
+func (i *RPCInfo) String() string {
+	versions := strconv.FormatUint(uint64(i.LowVersion), 10)
+	if i.HighVersion != i.LowVersion {
+		versions += "-" + strconv.FormatUint(uint64(i.HighVersion), 10)
+	}
+
+	return fmt.Sprintf("%s (RPC #%d)", versions, i.Program)
+}
+
+const (
+	rpcCall         = 0
+	rpcReply        = 1
+	rpcAccepted     = 0
+	rpcSuccess      = 0
+	rpcProgUnavail  = 1
+	rpcProgMismatch = 2
+
+	// rpcGrindVersion the version of grinding calls, one no program has so
+	// that the program answering tells the versions it supports
+	rpcGrindVersion = 0x7fffffff
+	// rpcGrindXID the transaction id of the first grinding call
+	rpcGrindXID = 0x4e4d4150
+	// maxRPCRecord caps the size of an RPC record read over TCP
+	maxRPCRecord = 64 * 1024
+)
+
+// Identify decodes the ONC RPC call a probe sent and the reply of the port:
+// the program is the one called, the versions those the reply reports as
+// supported (PROG_MISMATCH) or the called one when the call succeeded. Over
+// TCP both start with a record mark. It returns nil unless the reply accepts
+// the call.
+func (t *RPCTable) Identify(protocol string, call, reply []byte) *RPCInfo {
+	xid, program, version, ok := decodeRPCCall(protocol, call)
+	if !ok {
+		return nil
+	}
+	acceptStat, low, high, ok := decodeRPCReply(protocol, xid, reply)
+	if !ok {
+		return nil
+	}
+
+	switch acceptStat {
+	case rpcSuccess:
+		low, high = version, version
+	case rpcProgMismatch:
+	default:
+		return nil
+	}
+
+	return &RPCInfo{Program: program, Name: t.ProgramName(program), LowVersion: low, HighVersion: high}
+}
+
+// Grind finds the program of a port that speaks ONC RPC but not the program a
+// probe called, the way nmap's RPC grinding does: a NULL call of a version no
+// program has goes to every program of the table until one answers
+// PROG_MISMATCH with the versions it supports. exchange sends a call, with a
+// record mark over TCP, and returns the reply. It returns nil when no program
+// answers or an exchange fails.
+func (t *RPCTable) Grind(protocol string, exchange func(call []byte) ([]byte, error)) *RPCInfo {
+	tried := make(map[uint32]bool)
+	xid := uint32(rpcGrindXID)
+	for _, p := range t.Programs {
+		if tried[p.Number] {
+			continue
+		}
+		tried[p.Number] = true
+		xid++
+
+		reply, err := exchange(encodeRPCNullCall(protocol, xid, p.Number, rpcGrindVersion))
+		if err != nil {
+			return nil
+		}
+		acceptStat, low, high, ok := decodeRPCReply(protocol, xid, reply)
+		switch {
+		case !ok:
+			return nil
+		case acceptStat == rpcProgUnavail:
+			continue
+		case acceptStat == rpcProgMismatch:
+			return &RPCInfo{Program: p.Number, Name: p.Name, LowVersion: low, HighVersion: high}
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// rpcProgramUnavailable reports whether the reply to an RPC call refuses the
+// program called, the port speaks RPC for another program
+func rpcProgramUnavailable(protocol string, call, reply []byte) bool {
+	xid, _, _, ok := decodeRPCCall(protocol, call)
+	if !ok {
+		return false
+	}
+	acceptStat, _, _, ok := decodeRPCReply(protocol, xid, reply)
+
+	return ok && acceptStat == rpcProgUnavail
+}
+
+// rpcWord returns the i-th big-endian 32-bit word of b
+func rpcWord(b []byte, i int) (uint32, bool) {
+	if len(b) < 4*(i+1) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b[4*i:]), true
+}
+
+// decodeRPCCall returns the transaction id, program and version of a call
+func decodeRPCCall(protocol string, call []byte) (xid, program, version uint32, ok bool) {
+	if strings.EqualFold(protocol, "TCP") {
+		if len(call) < 4 {
+			return 0, 0, 0, false
+		}
+		call = call[4:]
+	}
+
+	// xid, CALL, RPC version 2, program, version
+	xid, _ = rpcWord(call, 0)
+	if msgType, _ := rpcWord(call, 1); msgType != rpcCall {
+		return 0, 0, 0, false
+	}
+	program, _ = rpcWord(call, 3)
+	version, ok = rpcWord(call, 4)
+
+	return xid, program, version, ok
+}
+
+// decodeRPCReply returns the accept state of the accepted reply to the call
+// xid, with the versions the program supports for PROG_MISMATCH
+func decodeRPCReply(protocol string, xid uint32, reply []byte) (acceptStat, low, high uint32, ok bool) {
+	if strings.EqualFold(protocol, "TCP") {
+		if len(reply) < 4 {
+			return 0, 0, 0, false
+		}
+		reply = reply[4:]
+	}
+
+	// xid, REPLY, MSG_ACCEPTED, verifier flavor and length, verifier, accept state
+	replyXID, _ := rpcWord(reply, 0)
+	msgType, _ := rpcWord(reply, 1)
+	replyStat, ok := rpcWord(reply, 2)
+	if !ok || replyXID != xid || msgType != rpcReply || replyStat != rpcAccepted {
+		return 0, 0, 0, false
+	}
+	verifierLen, ok := rpcWord(reply, 4)
+	if !ok || verifierLen > uint32(len(reply)) || 20+int(verifierLen+3)/4*4 > len(reply) {
+		return 0, 0, 0, false
+	}
+	body := reply[20+int(verifierLen+3)/4*4:]
+	if acceptStat, ok = rpcWord(body, 0); !ok {
+		return 0, 0, 0, false
+	}
+	if acceptStat == rpcProgMismatch {
+		low, okLow := rpcWord(body, 1)
+		high, okHigh := rpcWord(body, 2)
+		return acceptStat, low, high, okLow && okHigh
+	}
+
+	return acceptStat, 0, 0, true
+}
+
+// encodeRPCNullCall encodes a call of procedure 0 with AUTH_NULL credentials,
+// preceded by a record mark over TCP
+func encodeRPCNullCall(protocol string, xid, program, version uint32) []byte {
+	// xid, CALL, RPC version 2, program, version, NULL procedure, credentials, verifier
+	words := []uint32{xid, rpcCall, 2, program, version, 0, 0, 0, 0, 0}
+	call := make([]byte, 0, 4+4*len(words))
+	if strings.EqualFold(protocol, "TCP") {
+		call = binary.BigEndian.AppendUint32(call, 0x80000000|uint32(4*len(words)))
+	}
+	for _, w := range words {
+		call = binary.BigEndian.AppendUint32(call, w)
+	}
+
+	return call
+}
+
+// readRPCRecord reads the fragments of an RPC record over TCP, returned
+// behind a single record mark
+func readRPCRecord(r io.Reader) ([]byte, error) {
+	var body []byte
+	for {
+		var mark [4]byte
+		if _, err := io.ReadFull(r, mark[:]); err != nil {
+			return nil, err
+		}
+		size := binary.BigEndian.Uint32(mark[:]) & 0x7fffffff
+		if len(body)+int(size) > maxRPCRecord {
+			return nil, fmt.Errorf("RPC record larger than %d bytes", maxRPCRecord)
+		}
+		fragment := make([]byte, size)
+		if _, err := io.ReadFull(r, fragment); err != nil {
+			return nil, err
+		}
+		body = append(body, fragment...)
+		if mark[0]&0x80 != 0 {
+			break
+		}
+	}
+
+	return append(binary.BigEndian.AppendUint32(nil, 0x80000000|uint32(len(body))), body...), nil
+}
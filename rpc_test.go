@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rpcbindReply the TCP reply of an rpcbind supporting versions 2 to 4 to RPCCheck
+var rpcbindReply = []byte("\x80\x00\x00\x20\x72\xfe\x1d\x13\x00\x00\x00\x01\x00\x00\x00\x00" +
+	"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x00\x00\x02\x00\x00\x00\x04")
+
+func TestParseNmapRPC(t *testing.T) {
+	table, err := client.ParseNmapRPC("./tests/nmap-rpc")
+	assert.Nil(t, err)
+	assert.Len(t, table.Programs, 9)
+
+	assert.Equal(t, &RPCProgram{Name: "mountd", Number: 100005, Aliases: []string{"mount", "showmount"}, Line: 8},
+		table.Lookup(100005))
+	assert.Equal(t, "nlockmgr", table.ProgramName(100021))
+	assert.Equal(t, "", table.ProgramName(99))
+	assert.Equal(t, uint32(100000), table.ByName("portmap").Number)
+
+	for _, bad := range []string{"rpcbind\n", "rpcbind portmap\n", "rpcbind 4294967296\n"} {
+		_, err = client.ParseNmapRPCReader(strings.NewReader(bad), "bad")
+		assert.ErrorIs(t, err, ErrRPCLine, bad)
+	}
+}
+
+func TestRPCIdentify(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+	table, err := client.ParseNmapRPC("./tests/nmap-rpc")
+	assert.Nil(t, err)
+
+	call, err := db.Probe("TCP", "RPCCheck").Payload("")
+	assert.Nil(t, err)
+	info := table.Identify("TCP", call, rpcbindReply)
+	assert.Equal(t, &RPCInfo{Program: 100000, Name: "rpcbind", LowVersion: 2, HighVersion: 4}, info)
+	assert.Equal(t, "2-4 (RPC #100000)", info.String())
+
+	// UDP has no record mark
+	udpCall, err := db.Probe("UDP", "RPCCheck").Payload("")
+	assert.Nil(t, err)
+	assert.Equal(t, info, table.Identify("UDP", udpCall, rpcbindReply[4:]))
+
+	// another transaction, a denied call or a truncated reply identify nothing
+	other := append([]byte{}, rpcbindReply...)
+	other[7] ^= 0xff
+	assert.Nil(t, table.Identify("TCP", call, other))
+	denied := append([]byte{}, rpcbindReply...)
+	denied[15] = 1
+	assert.Nil(t, table.Identify("TCP", call, denied))
+	assert.Nil(t, table.Identify("TCP", call, rpcbindReply[:30]))
+
+	target := serve(t, func(conn net.Conn) {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		request := make([]byte, 64)
+		if n, err := conn.Read(request); err == nil && n > 8 && string(request[4:8]) == "\x72\xfe\x1d\x13" {
+			conn.Write(rpcbindReply)
+		}
+	})
+	detector := NewDetector(db, DetectOptions{ReadTimeout: 200 * time.Millisecond, RPC: table})
+	detection, err := detector.Detect(context.Background(), target)
+	assert.Nil(t, err)
+	assert.Equal(t, "rpcbind", detection.Service)
+	assert.Equal(t, info, detection.RPC)
+}
+
+// rpcReplyTo encodes the TCP reply of a program to a call, PROG_MISMATCH with
+// versions 2 to 4 for the program, PROG_UNAVAIL for the others
+func rpcReplyTo(call []byte, program uint32) []byte {
+	acceptStat := []uint32{rpcProgUnavail}
+	if binary.BigEndian.Uint32(call[16:]) == program {
+		acceptStat = []uint32{rpcProgMismatch, 2, 4}
+	}
+	words := append([]uint32{binary.BigEndian.Uint32(call[4:]), rpcReply, rpcAccepted, 0, 0}, acceptStat...)
+	reply := binary.BigEndian.AppendUint32(nil, 0x80000000|uint32(4*len(words)))
+	for _, w := range words {
+		reply = binary.BigEndian.AppendUint32(reply, w)
+	}
+
+	return reply
+}
+
+func TestRPCGrind(t *testing.T) {
+	table, err := client.ParseNmapRPC("./tests/nmap-rpc")
+	assert.Nil(t, err)
+
+	var called []uint32
+	info := table.Grind("TCP", func(call []byte) ([]byte, error) {
+		called = append(called, binary.BigEndian.Uint32(call[16:]))
+		assert.Equal(t, uint32(rpcGrindVersion), binary.BigEndian.Uint32(call[20:]))
+		return rpcReplyTo(call, 100003), nil
+	})
+	assert.Equal(t, &RPCInfo{Program: 100003, Name: "nfs", LowVersion: 2, HighVersion: 4}, info)
+	assert.Equal(t, []uint32{100000, 100001, 100002, 100003}, called)
+
+	// no program answering, a reply to another call or a failed exchange find nothing
+	assert.Nil(t, table.Grind("TCP", func(call []byte) ([]byte, error) { return rpcReplyTo(call, 99), nil }))
+	assert.Nil(t, table.Grind("TCP", func(call []byte) ([]byte, error) { return rpcbindReply, nil }))
+	assert.Nil(t, table.Grind("TCP", func(call []byte) ([]byte, error) { return nil, io.EOF }))
+
+	// over UDP calls and replies have no record mark
+	info = table.Grind("UDP", func(call []byte) ([]byte, error) {
+		return rpcReplyTo(append(make([]byte, 4), call...), 100005)[4:], nil
+	})
+	assert.Equal(t, "mountd", info.Name)
+
+	// the detector grinds ports refusing the program RPCCheck calls
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+	target := serve(t, func(conn net.Conn) {
+		for {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			call, err := readRPCRecord(conn)
+			if err != nil || len(call) < 24 {
+				return
+			}
+			conn.Write(rpcReplyTo(call, 100003))
+		}
+	})
+	detector := NewDetector(db, DetectOptions{ReadTimeout: 200 * time.Millisecond, RPC: table})
+	detection, err := detector.Detect(context.Background(), target)
+	assert.Nil(t, err)
+	assert.Equal(t, "nfs", detection.Service)
+	assert.Equal(t, "2-4 (RPC #100003)", detection.RPC.String())
+}
@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// JSONSchemaID the $id of the JSON Schema of JSONDocument
+const JSONSchemaID = "https://github.com/randolphcyg/nmap-parser/nmap-service-probes.schema.json"
+
+// JSONSchema returns the JSON Schema of JSONDocument, generated from the Go
+// types and their `json` and `desc` tags
+func JSONSchema() ([]byte, error) {
+	defs := make(map[string]interface{})
+	schemaOf(reflect.TypeOf(JSONDocument{}), defs)
+	root := defs["JSONDocument"].(map[string]interface{})
+	delete(defs, "JSONDocument")
+
+	schema := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         JSONSchemaID,
+		"title":       "nmap-service-probes",
+		"description": "Probe database parsed from nmap-service-probes, schema version 1",
+		"$defs":       defs,
+	}
+	for key, value := range root {
+		schema[key] = value
+	}
+	props := schema["properties"].(map[string]interface{})
+	props["schemaVersion"].(map[string]interface{})["const"] = JSONSchemaVersion
+
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// schemaOf returns the schema of a type, structs other than the root are added to defs
+func schemaOf(t reflect.Type, defs map[string]interface{}) interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), defs)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), defs)}
+	}
+
+	if _, ok := defs[t.Name()]; ok {
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	}
+	// reserve the name first, types may refer to themselves
+	defs[t.Name()] = nil
+
+	props := make(map[string]interface{})
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		prop := schemaOf(field.Type, defs).(map[string]interface{})
+		if desc := field.Tag.Get("desc"); desc != "" {
+			prop["description"] = desc
+		}
+		props[name] = prop
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	def := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+	defs[t.Name()] = def
+
+	return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+}
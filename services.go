@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrServicesLine = errors.New("nmap-services line is malformed")
+
+// ServiceEntry a line of nmap-services: a port, the service usually found
+// on it and the fraction of scanned hosts nmap found it open on
+type ServiceEntry struct {
+	Name      string  `json:"name"`
+	Port      int     `json:"port"`
+	Protocol  string  `json:"protocol"`
+	Frequency float64 `json:"frequency"`
+	Comment   string  `json:"comment,omitempty"`
+	Source    string  `json:"source,omitempty"`
+	Line      int     `json:"line,omitempty"`
+}
+
+// serviceKey a port of a protocol
+type serviceKey struct {
+	protocol string
+	port     int
+}
+
+// ServicesTable a parsed nmap-services file with lookups by port and by name
+type ServicesTable struct {
+	Entries []*ServiceEntry `json:"entries"`
+
+	byPort map[serviceKey]*ServiceEntry
+	byName map[string][]*ServiceEntry
+}
+
+// NewServicesTable builds the lookups of entries in file order. When a port
+// is listed twice the more frequent entry wins.
+func NewServicesTable(entries []*ServiceEntry) *ServicesTable {
+	t := &ServicesTable{
+		Entries: entries,
+		byPort:  make(map[serviceKey]*ServiceEntry),
+		byName:  make(map[string][]*ServiceEntry),
+	}
+	for _, e := range entries {
+		key := serviceKey{protocol: e.Protocol, port: e.Port}
+		if existing, ok := t.byPort[key]; !ok || e.Frequency > existing.Frequency {
+			t.byPort[key] = e
+		}
+		t.byName[e.Name] = append(t.byName[e.Name], e)
+	}
+
+	return t
+}
+
+// ParseNmapServices parse an nmap-services file
+func (c *Client) ParseNmapServices(srcFilePath string) (*ServicesTable, error) {
+	file, err := os.Open(srcFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return c.ParseNmapServicesReader(file, srcFilePath)
+}
+
+// ParseNmapServicesReader parse the nmap-services format from r, source
+// names the origin recorded in the Source fields
+func (c *Client) ParseNmapServicesReader(r io.Reader, source string) (*ServicesTable, error) {
+	var entries []*ServiceEntry
+	lineNo := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+		if strings.HasPrefix(line, "#") || len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		entry, err := parseServiceLine(line)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "%s:%d", source, lineNo)
+		}
+		entry.Source, entry.Line = source, lineNo
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewServicesTable(entries), nil
+}
+
+// parseServiceLine parse `name port/protocol [frequency] [# comment]`
+func parseServiceLine(line string) (*ServiceEntry, error) {
+	entry := &ServiceEntry{}
+	if i := strings.IndexByte(line, '#'); i != -1 {
+		line, entry.Comment = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, errors.WithMessage(ErrServicesLine, line)
+	}
+	entry.Name = fields[0]
+
+	port, protocol, ok := strings.Cut(fields[1], "/")
+	if !ok {
+		return nil, errors.WithMessage(ErrServicesLine, line)
+	}
+	var err error
+	if entry.Port, err = strconv.Atoi(port); err != nil || entry.Port < 0 || entry.Port > 65535 {
+		return nil, errors.WithMessage(ErrServicesLine, line)
+	}
+	entry.Protocol = strings.ToUpper(protocol)
+
+	if len(fields) == 3 {
+		if entry.Frequency, err = strconv.ParseFloat(fields[2], 64); err != nil {
+			return nil, errors.WithMessage(ErrServicesLine, line)
+		}
+	}
+
+	return entry, nil
+}
+
+// Len returns the number of entries
+func (t *ServicesTable) Len() int {
+	return len(t.Entries)
+}
+
+// Lookup returns the entry of a port, nil if it is not listed
+func (t *ServicesTable) Lookup(protocol string, port int) *ServiceEntry {
+	return t.byPort[serviceKey{protocol: strings.ToUpper(protocol), port: port}]
+}
+
+// ByName returns the entries of a service, in file order
+func (t *ServicesTable) ByName(name string) []*ServiceEntry {
+	return t.byName[name]
+}
+
+// TopPorts returns the n most frequently open ports of the protocol, like
+// nmap's --top-ports, nil when n is not positive
+func (t *ServicesTable) TopPorts(protocol string, n int) []int {
+	if n <= 0 {
+		return nil
+	}
+
+	var entries []*ServiceEntry
+	protocol = strings.ToUpper(protocol)
+	for key, e := range t.byPort {
+		if key.protocol == protocol {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Frequency != entries[j].Frequency {
+			return entries[i].Frequency > entries[j].Frequency
+		}
+		return entries[i].Port < entries[j].Port
+	})
+
+	if n > len(entries) {
+		n = len(entries)
+	}
+	ports := make([]int, n)
+	for i := range ports {
+		ports[i] = entries[i].Port
+	}
+
+	return ports
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNmapServices(t *testing.T) {
+	table, err := client.ParseNmapServices("./tests/nmap-services")
+	assert.Nil(t, err)
+	assert.Equal(t, 20, table.Len())
+
+	ssh := table.Lookup("tcp", 22)
+	if assert.NotNil(t, ssh) {
+		assert.Equal(t, &ServiceEntry{Name: "ssh", Port: 22, Protocol: "TCP", Frequency: 0.182286,
+			Comment: "Secure Shell Login", Source: "./tests/nmap-services", Line: 9}, ssh)
+	}
+	assert.Nil(t, table.Lookup("UDP", 22))
+	assert.Len(t, table.ByName("domain"), 2)
+	assert.Equal(t, []int{80, 23, 443}, table.TopPorts("TCP", 3))
+	assert.Equal(t, []int{161, 53, 111, 7, 1}, table.TopPorts("UDP", 10))
+	assert.Nil(t, table.TopPorts("TCP", 0))
+	assert.Nil(t, table.TopPorts("TCP", -1))
+
+	_, err = client.ParseNmapServicesReader(strings.NewReader("http\teighty/tcp\t0.1\n"), "bad")
+	assert.ErrorIs(t, err, ErrServicesLine)
+}
+
+func TestDetectorGuessedService(t *testing.T) {
+	db, err := client.ParseProbeDBReader(strings.NewReader("Probe TCP NULL q||\nmatch ftp m|^220 |\n"), "probes")
+	assert.Nil(t, err)
+
+	target := serve(t, func(conn net.Conn) {
+		conn.Write([]byte("* OK nothing known\r\n"))
+		time.Sleep(time.Second)
+	})
+	services, err := client.ParseNmapServicesReader(strings.NewReader(
+		"custom\t"+strconv.Itoa(target.Port)+"/tcp\t0.5\n"), "services")
+	assert.Nil(t, err)
+
+	detection, err := NewDetector(db, DetectOptions{ReadTimeout: 200 * time.Millisecond}).Detect(context.Background(), target)
+	assert.Nil(t, err)
+	assert.Equal(t, "", detection.Service)
+
+	detection, err = NewDetector(db, DetectOptions{ReadTimeout: 200 * time.Millisecond, Services: services}).Detect(context.Background(), target)
+	assert.Nil(t, err)
+	assert.Equal(t, "custom", detection.Service)
+	assert.True(t, detection.Guessed)
+}
@@ -0,0 +1,220 @@
+package parser
+
+import (
+	"math/rand"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// DefaultShadowSamples the number of strings generated from each pattern by default
+const DefaultShadowSamples = 16
+
+// maxSampleRepeat the extra repetitions at most generated for `*`, `+` and `{n,}`
+const maxSampleRepeat = 3
+
+// ShadowOptions options of FindShadowedRules
+type ShadowOptions struct {
+	// Samples the number of strings generated from each pattern, DefaultShadowSamples when zero
+	Samples int
+	// Banners responses tried against the rules of every probe along with the generated samples
+	Banners [][]byte
+}
+
+// FindShadowedRules finds the rules of each probe that are always preceded by
+// another rule: every sample the rule matches, whether generated from its
+// pattern or taken from the supplied banners, is claimed first by an earlier
+// hard match, or by an earlier softmatch of another service, which limits the
+// rules nmap tries afterwards to that service. The result is a likely answer,
+// not a proof. Rules whose pattern Go cannot compile are not analysed.
+func FindShadowedRules(db *ProbeDB, opts ShadowOptions) []*ShadowedRule {
+	if opts.Samples <= 0 {
+		opts.Samples = DefaultShadowSamples
+	}
+	banners := make([]string, 0, len(opts.Banners))
+	for _, banner := range opts.Banners {
+		banners = append(banners, latin1String(banner))
+	}
+
+	var shadowed []*ShadowedRule
+	for _, p := range db.Probes {
+		shadowed = append(shadowed, findShadowedInProbe(p, opts.Samples, banners)...)
+	}
+
+	return shadowed
+}
+
+func findShadowedInProbe(p *Probe, n int, banners []string) (shadowed []*ShadowedRule) {
+	compiled := make([]*regexp.Regexp, len(p.Matches))
+	for i, m := range p.Matches {
+		compiled[i], _ = CompilePattern(m)
+	}
+
+	for i, m := range p.Matches {
+		if compiled[i] == nil || i == 0 {
+			continue
+		}
+
+		matched := 0
+		claims := make(map[*Match]int)
+		reachable := false
+		for _, sample := range append(generateSamples(m, n), banners...) {
+			if !compiled[i].MatchString(sample) {
+				continue
+			}
+			matched++
+			by := blockingRule(p.Matches[:i], compiled[:i], m, sample)
+			if by == nil {
+				reachable = true
+				break
+			}
+			claims[by]++
+		}
+		if reachable || matched == 0 {
+			continue
+		}
+
+		// blame the earlier rule claiming the most samples, the first one on ties
+		var by *Match
+		for _, e := range p.Matches[:i] {
+			if by == nil || claims[e] > claims[by] {
+				by = e
+			}
+		}
+		shadowed = append(shadowed, &ShadowedRule{Protocol: p.Protocol, ProbeName: p.ProbeName, Rule: m, By: by, Samples: matched})
+	}
+
+	return shadowed
+}
+
+// blockingRule returns the first earlier rule that keeps m from being tried on the subject
+func blockingRule(earlier []*Match, compiled []*regexp.Regexp, m *Match, subject string) *Match {
+	for i, e := range earlier {
+		if compiled[i] == nil || e.Soft && e.Name == m.Name {
+			continue
+		}
+		if compiled[i].MatchString(subject) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// generateSamples generates up to n distinct strings from the pattern of a rule,
+// the first one with the fewest repetitions and the first alternatives. Like
+// the subjects of compiled patterns, samples hold one rune per byte.
+func generateSamples(m *Match, n int) []string {
+	re, err := syntax.Parse(goPattern(m), syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	re = re.Simplify()
+
+	g := &sampleGenerator{rnd: rand.New(rand.NewSource(int64(len(m.Pattern))))}
+	samples := make([]string, 0, n)
+	seen := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		g.sb.Reset()
+		g.minimal = i == 0
+		g.failed = false
+		g.write(re)
+
+		sample := g.sb.String()
+		if !g.failed && !seen[sample] {
+			seen[sample] = true
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples
+}
+
+// sampleGenerator writes random strings matching a parsed pattern
+type sampleGenerator struct {
+	rnd     *rand.Rand
+	sb      strings.Builder
+	minimal bool
+	failed  bool
+}
+
+func (g *sampleGenerator) write(re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		g.failed = true
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 && !g.minimal && g.rnd.Intn(2) == 0 {
+				if folded := unicode.SimpleFold(r); folded <= 0xff {
+					r = folded
+				}
+			}
+			g.sb.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		g.writeClass(re.Rune)
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		g.sb.WriteRune(rune(' ' + g.rnd.Intn('~'-' '+1)))
+	case syntax.OpCapture:
+		g.write(re.Sub[0])
+	case syntax.OpStar:
+		g.repeat(re.Sub[0], 0, -1)
+	case syntax.OpPlus:
+		g.repeat(re.Sub[0], 1, -1)
+	case syntax.OpQuest:
+		g.repeat(re.Sub[0], 0, 1)
+	case syntax.OpRepeat:
+		g.repeat(re.Sub[0], re.Min, re.Max)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			g.write(sub)
+		}
+	case syntax.OpAlternate:
+		if g.minimal {
+			g.write(re.Sub[0])
+		} else {
+			g.write(re.Sub[g.rnd.Intn(len(re.Sub))])
+		}
+	}
+}
+
+// writeClass writes a rune of the class, which holds pairs of inclusive bounds,
+// limited to the byte range
+func (g *sampleGenerator) writeClass(ranges []rune) {
+	var bounded []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		if ranges[i] <= 0xff {
+			high := ranges[i+1]
+			if high > 0xff {
+				high = 0xff
+			}
+			bounded = append(bounded, ranges[i], high)
+		}
+	}
+	if len(bounded) == 0 {
+		g.failed = true
+		return
+	}
+	if g.minimal {
+		g.sb.WriteRune(bounded[0])
+		return
+	}
+
+	i := 2 * g.rnd.Intn(len(bounded)/2)
+	g.sb.WriteRune(bounded[i] + rune(g.rnd.Intn(int(bounded[i+1]-bounded[i])+1)))
+}
+
+// repeat writes sub between min and max times, max -1 meaning unbounded
+func (g *sampleGenerator) repeat(sub *syntax.Regexp, min, max int) {
+	if max == -1 || max > min+maxSampleRepeat {
+		max = min + maxSampleRepeat
+	}
+	count := min
+	if !g.minimal {
+		count += g.rnd.Intn(max - min + 1)
+	}
+	for i := 0; i < count; i++ {
+		g.write(sub)
+	}
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const shadowSrc = `Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+match http m|^HTTP/1\.[01] \d\d\d| p/generic/
+match http m|^HTTP/1\.[01] 200 OK\r\nServer: Apache/([\d.]+)| p/Apache httpd/ v/$1/
+match ftp m|^220 ([\w.]+) FTP| p/$1/
+match ftp m|^220 |
+
+Probe TCP Help q|HELP\r\n|
+softmatch proxy m|^HTTP/1\.1 407 |
+match http-proxy m|^HTTP/1\.1 407 Proxy Authentication Required\r\nServer: Squid| p/Squid/
+match proxy m|^HTTP/1\.1 407 Proxy Authentication Required| p/generic proxy/
+match ftp m|^220 \w+ FTP|
+match ftp m=^220 (?:\w+ FTP|ready)= i/reachable through banners/
+`
+
+func TestFindShadowedRules(t *testing.T) {
+	db, err := client.ParseProbeDBReader(strings.NewReader(shadowSrc), "shadow")
+	assert.Nil(t, err)
+
+	shadowed := FindShadowedRules(db, ShadowOptions{})
+	lines := make(map[int]int)
+	for _, s := range shadowed {
+		lines[s.Rule.Line] = s.By.Line
+	}
+	assert.Equal(t, map[int]int{3: 2, 9: 8}, lines)
+	assert.Greater(t, shadowed[0].Samples, 1)
+
+	// the only sample takes the first alternative of the last rule
+	shadowed = FindShadowedRules(db, ShadowOptions{Samples: 1})
+	assert.Len(t, shadowed, 3)
+
+	// the banner is matched by the last rule only
+	shadowed = FindShadowedRules(db, ShadowOptions{Samples: 1, Banners: [][]byte{[]byte("220 ready\r\n")}})
+	assert.Len(t, shadowed, 2)
+}
+
+func TestGenerateSamples(t *testing.T) {
+	m := &Match{Pattern: `^SSH-([\d.]+)-OpenSSH_(\w+)(?: |\r\n)`, PatternFlag: "i"}
+	re, err := CompilePattern(m)
+	assert.Nil(t, err)
+
+	samples := generateSamples(m, 8)
+	assert.NotEmpty(t, samples)
+	assert.True(t, strings.EqualFold("SSH-.-OpenSSH_0 ", samples[0]))
+	for _, sample := range samples {
+		assert.Regexp(t, re, sample)
+	}
+}
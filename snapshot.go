@@ -0,0 +1,512 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/randolphcyg/cpe"
+)
+
+// SnapshotVersion the version of the snapshot format, snapshots of other versions are rejected
+const SnapshotVersion = 2
+
+// snapshotMagic starts every snapshot
+const snapshotMagic = "NMAPPDB\x00"
+
+var ErrSnapshot = errors.New("invalid probe database snapshot")
+
+// WriteSnapshot writes a binary snapshot of a probe database holding the
+// parsed probes along with their prefilters and version info templates, so
+// LoadSnapshot does not have to redo that work. A snapshot is the magic
+// `NMAPPDB\0`, the format version as a big endian uint16, the SHA-256 of the
+// body and the body.
+func (c *Client) WriteSnapshot(w io.Writer, db *ProbeDB) error {
+	s := &snapshotWriter{}
+	s.strings(db.Exclude)
+	s.uint(len(db.Probes))
+	for _, p := range db.Probes {
+		s.probe(p)
+		s.prefilter(db.prefilter(p))
+		for _, m := range p.Matches {
+			s.template(newMatchTemplate(m))
+		}
+	}
+
+	checksum := sha256.Sum256(s.buf)
+	header := make([]byte, 0, len(snapshotMagic)+2+len(checksum))
+	header = append(header, snapshotMagic...)
+	header = binary.BigEndian.AppendUint16(header, SnapshotVersion)
+	header = append(header, checksum[:]...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(s.buf)
+
+	return err
+}
+
+// LoadSnapshot reads a snapshot written by WriteSnapshot after checking its
+// version and checksum. Patterns are compiled on first use.
+func (c *Client) LoadSnapshot(r io.Reader) (*ProbeDB, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := len(snapshotMagic) + 2 + sha256.Size
+	if len(data) < headerLen || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.WithMessage(ErrSnapshot, "not a snapshot")
+	}
+	if version := binary.BigEndian.Uint16(data[len(snapshotMagic):]); version != SnapshotVersion {
+		return nil, errors.WithMessagef(ErrSnapshot, "unsupported version %d", version)
+	}
+	body := data[headerLen:]
+	if checksum := sha256.Sum256(body); !bytes.Equal(checksum[:], data[headerLen-sha256.Size:headerLen]) {
+		return nil, errors.WithMessage(ErrSnapshot, "checksum mismatch")
+	}
+
+	// strings of the snapshot are substrings of a single copy of the body
+	s := &snapshotReader{buf: string(body)}
+	exclude := s.strings()
+	probes := make([]*Probe, s.uint())
+	prefilters := make([]*probePrefilter, len(probes))
+	templates := make([][]*matchTemplate, len(probes))
+	for i := range probes {
+		probes[i] = s.probe()
+		if prefilters[i] = s.prefilter(); prefilters[i].rules != len(probes[i].Matches) {
+			s.fail()
+		}
+		templates[i] = make([]*matchTemplate, len(probes[i].Matches))
+		for j, m := range probes[i].Matches {
+			if templates[i][j] = s.template(); !templates[i][j].fits(m) {
+				s.fail()
+			}
+		}
+	}
+	if s.err == nil && s.pos != len(s.buf) {
+		s.fail()
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	db := NewProbeDB(probes, exclude...)
+	for i, p := range probes {
+		prefilters[i].matches = append([]*Match(nil), p.Matches...)
+		db.prefilters.Store(p, prefilters[i])
+		for j, m := range p.Matches {
+			db.templates.Store(m, templates[i][j])
+		}
+	}
+
+	return db, nil
+}
+
+// snapshotWriter encodes the body of a snapshot. Numbers are uvarints,
+// strings and lists are prefixed by their length and lists by their length
+// plus one, zero standing for nil.
+type snapshotWriter struct {
+	buf []byte
+}
+
+func (s *snapshotWriter) uint(n int) {
+	s.buf = binary.AppendUvarint(s.buf, uint64(n))
+}
+
+func (s *snapshotWriter) int(n int) {
+	s.buf = binary.AppendVarint(s.buf, int64(n))
+}
+
+func (s *snapshotWriter) bool(b bool) {
+	if b {
+		s.buf = append(s.buf, 1)
+	} else {
+		s.buf = append(s.buf, 0)
+	}
+}
+
+func (s *snapshotWriter) string(str string) {
+	s.uint(len(str))
+	s.buf = append(s.buf, str...)
+}
+
+// list writes the length prefix of a list of n items
+func (s *snapshotWriter) list(n int, isNil bool) {
+	if isNil {
+		s.uint(0)
+		return
+	}
+	s.uint(n + 1)
+}
+
+func (s *snapshotWriter) strings(items []string) {
+	s.list(len(items), items == nil)
+	for _, item := range items {
+		s.string(item)
+	}
+}
+
+func (s *snapshotWriter) probe(p *Probe) {
+	for _, field := range []string{p.Protocol, p.ProbeName, p.ProbeString, p.TcpWrappedMs, p.TotalWaitMs,
+		p.Rarity, p.Fallback, p.Source, p.Comment} {
+		s.string(field)
+	}
+	s.strings(p.Ports)
+	s.strings(p.SslPorts)
+	s.bool(p.NoPayload)
+	s.int(p.Line)
+	names := make([]string, 0, len(p.DirectiveLines))
+	for name := range p.DirectiveLines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s.list(len(names), p.DirectiveLines == nil)
+	for _, name := range names {
+		s.string(name)
+		s.int(p.DirectiveLines[name])
+	}
+
+	s.list(len(p.Matches), p.Matches == nil)
+	for _, m := range p.Matches {
+		for _, field := range []string{m.Pattern, m.Name, m.PatternFlag, m.Source, m.Comment} {
+			s.string(field)
+		}
+		s.bool(m.Soft)
+		s.int(m.Line)
+		s.versionInfo(m.VersionInfo)
+	}
+}
+
+func (s *snapshotWriter) versionInfo(v *VInfo) {
+	s.bool(v != nil)
+	if v == nil {
+		return
+	}
+	for _, field := range []string{v.VendorProductName, v.Version, v.Info, v.Hostname, v.OperatingSystem, v.DeviceType} {
+		s.string(field)
+	}
+	s.list(len(v.Cpe), v.Cpe == nil)
+	for _, c := range v.Cpe {
+		for _, field := range []string{c.Part, c.Vendor, c.Product, c.Version, c.Update, c.Edition, c.Language,
+			c.SwEdition, c.TargetSw, c.TargetHw, c.Other} {
+			s.string(field)
+		}
+	}
+	s.strings(v.CpeFlags)
+}
+
+func (s *snapshotWriter) prefilter(f *probePrefilter) {
+	s.uint(f.rules)
+	s.uint(len(f.always))
+	for _, i := range f.always {
+		s.uint(i)
+	}
+	s.automaton(f.exact)
+	s.automaton(f.folded)
+}
+
+func (s *snapshotWriter) automaton(a *ahoCorasick) {
+	s.uint(len(a.keys))
+	for _, k := range a.keys {
+		s.uint(k.length)
+		s.uint(k.rule)
+		s.bool(k.anchored)
+	}
+
+	s.uint(len(a.nodes))
+	for i, node := range a.nodes {
+		s.uint(int(node.fail))
+		s.int(int(node.dict))
+		out := a.output(int32(i))
+		s.uint(len(out))
+		for _, k := range out {
+			s.uint(int(k))
+		}
+		edges := a.edges[node.edges:node.edgesEnd]
+		s.uint(len(edges))
+		for _, e := range edges {
+			s.buf = append(s.buf, e.b)
+			s.uint(int(e.next))
+		}
+	}
+}
+
+func (s *snapshotWriter) template(t *matchTemplate) {
+	s.uint(len(t.Fields))
+	for _, field := range t.Fields {
+		s.versionTemplate(field)
+	}
+	s.uint(len(t.Cpe))
+	for _, attrs := range t.Cpe {
+		s.uint(len(attrs))
+		for _, attr := range attrs {
+			s.versionTemplate(attr)
+		}
+	}
+}
+
+func (s *snapshotWriter) versionTemplate(t versionTemplate) {
+	s.list(len(t), t == nil)
+	for _, node := range t {
+		s.string(node.Literal)
+		s.int(node.Group)
+		s.string(node.Helper)
+		s.strings(node.Args)
+	}
+}
+
+// snapshotReader decodes the body of a snapshot, the first error sticks and
+// every later read returns zero values
+type snapshotReader struct {
+	buf string
+	pos int
+	err error
+}
+
+func (s *snapshotReader) fail() {
+	if s.err == nil {
+		s.err = errors.WithMessagef(ErrSnapshot, "malformed body at offset %d", s.pos)
+	}
+	s.pos = len(s.buf)
+}
+
+func (s *snapshotReader) uvarint() uint64 {
+	var n uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if s.pos >= len(s.buf) {
+			break
+		}
+		b := s.buf[s.pos]
+		s.pos++
+		n |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return n
+		}
+	}
+	s.fail()
+
+	return 0
+}
+
+func (s *snapshotReader) uint() int {
+	n := s.uvarint()
+	if n > uint64(len(s.buf)) {
+		// no count or offset of a snapshot exceeds its size
+		s.fail()
+		return 0
+	}
+
+	return int(n)
+}
+
+func (s *snapshotReader) int() int {
+	n := s.uvarint()
+	return int(int64(n>>1) ^ -int64(n&1))
+}
+
+func (s *snapshotReader) bool() bool {
+	return s.byte() == 1
+}
+
+func (s *snapshotReader) byte() byte {
+	if s.pos >= len(s.buf) {
+		s.fail()
+		return 0
+	}
+	s.pos++
+
+	return s.buf[s.pos-1]
+}
+
+func (s *snapshotReader) string() string {
+	n := s.uint()
+	if s.pos+n > len(s.buf) {
+		s.fail()
+		return ""
+	}
+	s.pos += n
+
+	return s.buf[s.pos-n : s.pos]
+}
+
+// length reads the length prefix of a list, -1 for nil
+func (s *snapshotReader) length() int {
+	return s.uint() - 1
+}
+
+func (s *snapshotReader) strings() []string {
+	n := s.length()
+	if n < 0 {
+		return nil
+	}
+	items := make([]string, n)
+	for i := range items {
+		items[i] = s.string()
+	}
+
+	return items
+}
+
+func (s *snapshotReader) probe() *Probe {
+	p := &Probe{}
+	for _, field := range []*string{&p.Protocol, &p.ProbeName, &p.ProbeString, &p.TcpWrappedMs, &p.TotalWaitMs,
+		&p.Rarity, &p.Fallback, &p.Source, &p.Comment} {
+		*field = s.string()
+	}
+	p.Ports = s.strings()
+	p.SslPorts = s.strings()
+	p.NoPayload = s.bool()
+	p.Line = s.int()
+	if n := s.length(); n >= 0 {
+		p.DirectiveLines = make(map[string]int, n)
+		for i := 0; i < n; i++ {
+			name := s.string()
+			p.DirectiveLines[name] = s.int()
+		}
+	}
+
+	if n := s.length(); n >= 0 {
+		p.Matches = make([]*Match, n)
+		for i := range p.Matches {
+			m := &Match{}
+			for _, field := range []*string{&m.Pattern, &m.Name, &m.PatternFlag, &m.Source, &m.Comment} {
+				*field = s.string()
+			}
+			m.Soft = s.bool()
+			m.Line = s.int()
+			m.VersionInfo = s.versionInfo()
+			p.Matches[i] = m
+		}
+	}
+
+	return p
+}
+
+func (s *snapshotReader) versionInfo() *VInfo {
+	if !s.bool() {
+		return nil
+	}
+
+	v := &VInfo{}
+	for _, field := range []*string{&v.VendorProductName, &v.Version, &v.Info, &v.Hostname, &v.OperatingSystem, &v.DeviceType} {
+		*field = s.string()
+	}
+	if n := s.length(); n >= 0 {
+		v.Cpe = make([]*cpe.CPE, n)
+		for i := range v.Cpe {
+			c := &cpe.CPE{}
+			for _, field := range []*string{&c.Part, &c.Vendor, &c.Product, &c.Version, &c.Update, &c.Edition,
+				&c.Language, &c.SwEdition, &c.TargetSw, &c.TargetHw, &c.Other} {
+				*field = s.string()
+			}
+			v.Cpe[i] = c
+		}
+	}
+	v.CpeFlags = s.strings()
+
+	return v
+}
+
+func (s *snapshotReader) prefilter() *probePrefilter {
+	f := &probePrefilter{rules: s.uint()}
+	if n := s.uint(); n > 0 {
+		f.always = make([]int, n)
+		for i := range f.always {
+			f.always[i] = s.index(f.rules)
+		}
+	}
+	f.exact = s.automaton(f.rules)
+	f.folded = s.automaton(f.rules)
+
+	return f
+}
+
+// index reads a number that has to be below n
+func (s *snapshotReader) index(n int) int {
+	i := s.uint()
+	if i >= n {
+		s.fail()
+		return 0
+	}
+
+	return i
+}
+
+func (s *snapshotReader) automaton(rules int) *ahoCorasick {
+	a := &ahoCorasick{keys: make([]acKey, s.uint())}
+	for i := range a.keys {
+		a.keys[i] = acKey{length: s.uint(), rule: s.index(rules), anchored: s.bool()}
+	}
+
+	nodes := s.uint()
+	if nodes == 0 {
+		s.fail()
+		return &ahoCorasick{nodes: []acNode{{dict: -1}}}
+	}
+	a.nodes = make([]acNode, nodes)
+	a.edges = make([]acEdge, 0, nodes-1)
+	a.keyIndex = make([]int32, 0, len(a.keys))
+	for i := range a.nodes {
+		node := &a.nodes[i]
+		node.fail = int32(s.index(nodes))
+		if node.dict = int32(s.int()); node.dict < -1 || int(node.dict) >= nodes {
+			s.fail()
+			node.dict = -1
+		}
+
+		node.out = int32(len(a.keyIndex))
+		for n := s.uint(); n > 0; n-- {
+			a.keyIndex = append(a.keyIndex, int32(s.index(len(a.keys))))
+		}
+		node.outEnd = int32(len(a.keyIndex))
+
+		node.edges = int32(len(a.edges))
+		for n := s.uint(); n > 0; n-- {
+			a.edges = append(a.edges, acEdge{b: s.byte(), next: int32(s.index(nodes))})
+		}
+		node.edgesEnd = int32(len(a.edges))
+	}
+	for _, e := range a.edges[a.nodes[0].edges:a.nodes[0].edgesEnd] {
+		a.root[e.b] = e.next
+	}
+
+	return a
+}
+
+func (s *snapshotReader) template() *matchTemplate {
+	t := &matchTemplate{Fields: make([]versionTemplate, s.uint())}
+	for i := range t.Fields {
+		t.Fields[i] = s.versionTemplate()
+	}
+	if n := s.uint(); n > 0 {
+		t.Cpe = make([][]versionTemplate, n)
+		for i := range t.Cpe {
+			t.Cpe[i] = make([]versionTemplate, s.uint())
+			for j := range t.Cpe[i] {
+				t.Cpe[i][j] = s.versionTemplate()
+			}
+		}
+	}
+
+	return t
+}
+
+func (s *snapshotReader) versionTemplate() versionTemplate {
+	n := s.length()
+	if n < 0 {
+		return nil
+	}
+	t := make(versionTemplate, n)
+	for i := range t {
+		t[i] = templateNode{Literal: s.string(), Group: s.int(), Helper: s.string(), Args: s.strings()}
+		if t[i].Group < 0 || !validHelperArgs(t[i].Helper, t[i].Args) {
+			s.fail()
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteLoadSnapshot(t *testing.T) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, client.WriteSnapshot(&buf, db))
+	data := buf.Bytes()
+
+	loaded, err := client.LoadSnapshot(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, db.Exclude, loaded.Exclude)
+	assert.Equal(t, db.Probes, loaded.Probes)
+
+	null := loaded.Probe("TCP", "NULL")
+	result := loaded.MatchResponse(null, []byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1\r\n"))
+	if assert.NotNil(t, result) {
+		assert.Equal(t, "ssh", result.Service)
+		assert.Equal(t, "8.9p1 Ubuntu 3ubuntu0.1", result.VersionInfo.Version)
+		assert.Equal(t, "cpe:/a:openbsd:openssh:8.9p1", result.VersionInfo.CPE22URIs()[0])
+	}
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	_, err = client.LoadSnapshot(bytes.NewReader(corrupted))
+	assert.ErrorIs(t, err, ErrSnapshot)
+
+	// snapshots of other format versions, such as the first one without
+	// directive lines, are rejected
+	for _, version := range []byte{SnapshotVersion - 1, SnapshotVersion + 1} {
+		other := append([]byte{}, data...)
+		other[len(snapshotMagic)+1] = version
+		_, err = client.LoadSnapshot(bytes.NewReader(other))
+		assert.ErrorIs(t, err, ErrSnapshot)
+	}
+
+	_, err = client.LoadSnapshot(bytes.NewReader([]byte("Probe TCP NULL q||")))
+	assert.ErrorIs(t, err, ErrSnapshot)
+}
+
+func BenchmarkLoadSnapshot(b *testing.B) {
+	db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = client.WriteSnapshot(&buf, db); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = client.LoadSnapshot(bytes.NewReader(buf.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParsePrepared does the work a snapshot saves: parsing the probe
+// file and building every prefilter and template
+func BenchmarkParsePrepared(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		db, err := client.ParseProbeDB("./tests/nmap-service-probes")
+		if err != nil {
+			b.Fatal(err)
+		}
+		db.EachMatch(func(p *Probe, m *Match) bool {
+			db.prefilter(p)
+			db.fillVersionInfo(m, nil)
+			return true
+		})
+	}
+}
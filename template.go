@@ -0,0 +1,251 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/randolphcyg/cpe"
+)
+
+// templateNode a piece of a version info template: literal text, a `$n`
+// group reference or one of the helpers `$P(n)`, `$SUBST(n,"a","b")` and `$I(n,">")`
+type templateNode struct {
+	Literal string
+	Group   int
+	Helper  string
+	Args    []string
+}
+
+// String renders the node as it is written in a template
+func (n templateNode) String() string {
+	switch n.Helper {
+	case "":
+		if n.Literal != "" {
+			return n.Literal
+		}
+		return "$" + strconv.Itoa(n.Group)
+	default:
+		args := ""
+		for _, arg := range n.Args {
+			args += `,"` + arg + `"`
+		}
+		return "$" + n.Helper + "(" + strconv.Itoa(n.Group) + args + ")"
+	}
+}
+
+// versionTemplate a parsed version info template
+type versionTemplate []templateNode
+
+// parseTemplate parses a version info field or CPE attribute. Text that is
+// not a valid reference or helper call is kept as a literal.
+func parseTemplate(s string) versionTemplate {
+	var t versionTemplate
+	var literal strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '$' {
+			if node, n := parseTemplateRef(s[i+1:]); n > 0 {
+				if literal.Len() > 0 {
+					t = append(t, templateNode{Literal: literal.String()})
+					literal.Reset()
+				}
+				t = append(t, node)
+				i += n
+				continue
+			}
+		}
+		literal.WriteByte(s[i])
+	}
+	if literal.Len() > 0 {
+		t = append(t, templateNode{Literal: literal.String()})
+	}
+
+	return t
+}
+
+// parseTemplateRef parses what follows a `$`, returning the node and the
+// number of bytes it spans, 0 if it is not a reference
+func parseTemplateRef(s string) (templateNode, int) {
+	if digits := leadingDigits(s); digits > 0 {
+		group, _ := strconv.Atoi(s[:digits])
+		return templateNode{Group: group}, digits
+	}
+
+	for _, helper := range []string{"P", "SUBST", "I"} {
+		if !strings.HasPrefix(s, helper+"(") {
+			continue
+		}
+		rest := s[len(helper)+1:]
+		digits := leadingDigits(rest)
+		if digits == 0 {
+			return templateNode{}, 0
+		}
+		group, _ := strconv.Atoi(rest[:digits])
+		n := len(helper) + 1 + digits
+		rest = rest[digits:]
+
+		var args []string
+		for strings.HasPrefix(rest, `,"`) {
+			end := strings.IndexByte(rest[2:], '"')
+			if end == -1 {
+				return templateNode{}, 0
+			}
+			args = append(args, rest[2:2+end])
+			n += end + 3
+			rest = rest[end+3:]
+		}
+		if !strings.HasPrefix(rest, ")") || !validHelperArgs(helper, args) {
+			return templateNode{}, 0
+		}
+
+		return templateNode{Group: group, Helper: helper, Args: args}, n + 1
+	}
+
+	return templateNode{}, 0
+}
+
+func leadingDigits(s string) int {
+	n := 0
+	for n < len(s) && '0' <= s[n] && s[n] <= '9' {
+		n++
+	}
+
+	return n
+}
+
+func validHelperArgs(helper string, args []string) bool {
+	switch helper {
+	case "SUBST":
+		return len(args) == 2
+	case "I":
+		return len(args) == 1
+	}
+
+	return len(args) == 0
+}
+
+// refs returns the group references and helper calls of the template
+func (t versionTemplate) refs() (refs []templateNode) {
+	for _, node := range t {
+		if node.Literal == "" {
+			refs = append(refs, node)
+		}
+	}
+
+	return refs
+}
+
+// fill replaces references with the captures, groups the pattern does not
+// have or that did not participate are replaced with nothing
+func (t versionTemplate) fill(captures [][]byte) string {
+	if len(t) == 1 && t[0].Literal != "" {
+		return t[0].Literal
+	}
+
+	var sb strings.Builder
+	for _, node := range t {
+		if node.Literal != "" {
+			sb.WriteString(node.Literal)
+			continue
+		}
+
+		var capture []byte
+		if node.Group < len(captures) {
+			capture = captures[node.Group]
+		}
+		switch node.Helper {
+		case "P":
+			sb.WriteString(helperP(string(capture)))
+		case "SUBST":
+			sb.WriteString(helperSubst(string(capture), node.Args[0], node.Args[1]))
+		case "I":
+			sb.WriteString(strconv.Itoa(int(helperI(node.Args[0], capture))))
+		default:
+			sb.Write(capture)
+		}
+	}
+
+	return sb.String()
+}
+
+// matchTemplate the parsed templates of a rule: the six version info fields
+// in the order of vInfoFields, then the attributes of every CPE in the order
+// of cpeAttributes
+type matchTemplate struct {
+	Fields []versionTemplate
+	Cpe    [][]versionTemplate
+}
+
+func newMatchTemplate(m *Match) *matchTemplate {
+	t := &matchTemplate{}
+	v := m.VersionInfo
+	if v == nil {
+		return t
+	}
+
+	for _, flag := range vInfoFields {
+		t.Fields = append(t.Fields, parseTemplate(*v.vInfoField(flag)))
+	}
+	for _, c := range v.Cpe {
+		var attributes []versionTemplate
+		for _, value := range cpeAttributes(c) {
+			attributes = append(attributes, parseTemplate(value))
+		}
+		t.Cpe = append(t.Cpe, attributes)
+	}
+
+	return t
+}
+
+// fits reports whether the template has the shape newMatchTemplate gives the rule
+func (t *matchTemplate) fits(m *Match) bool {
+	if m.VersionInfo == nil {
+		return len(t.Fields) == 0 && len(t.Cpe) == 0
+	}
+	if len(t.Fields) != len(vInfoFields) || len(t.Cpe) != len(m.VersionInfo.Cpe) {
+		return false
+	}
+	for _, attributes := range t.Cpe {
+		if len(attributes) != len(cpeAttributes(&cpe.CPE{})) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fill returns the version info of a rule filled from the captures
+func (t *matchTemplate) fill(m *Match, captures [][]byte) *VInfo {
+	v := &VInfo{}
+	for i, flag := range vInfoFields[:len(t.Fields)] {
+		*v.vInfoField(flag) = t.Fields[i].fill(captures)
+	}
+
+	for i, attributes := range t.Cpe {
+		values := make([]string, len(attributes))
+		for j, attribute := range attributes {
+			values[j] = attribute.fill(captures)
+		}
+		v.Cpe = append(v.Cpe, &cpe.CPE{
+			// the part is never a template
+			Part: m.VersionInfo.Cpe[i].Part, Vendor: values[1], Product: values[2], Version: values[3],
+			Update: values[4], Edition: values[5], Language: values[6], SwEdition: values[7],
+			TargetSw: values[8], TargetHw: values[9], Other: values[10],
+		})
+	}
+	if m.VersionInfo != nil {
+		v.CpeFlags = m.VersionInfo.CpeFlags
+	}
+
+	return v
+}
+
+// fillVersionInfo fills the version info of a rule with the templates parsed
+// once per rule
+func (db *ProbeDB) fillVersionInfo(m *Match, captures [][]byte) *VInfo {
+	cached, ok := db.templates.Load(m)
+	if !ok {
+		cached, _ = db.templates.LoadOrStore(m, newMatchTemplate(m))
+	}
+
+	return cached.(*matchTemplate).fill(m, captures)
+}
@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tmpl := parseTemplate(`v$1.$SUBST(2,"_",".") $I(3,"<") cost $5$`)
+	assert.Equal(t, versionTemplate{
+		{Literal: "v"},
+		{Group: 1},
+		{Literal: "."},
+		{Group: 2, Helper: "SUBST", Args: []string{"_", "."}},
+		{Literal: " "},
+		{Group: 3, Helper: "I", Args: []string{"<"}},
+		{Literal: " cost "},
+		{Group: 5},
+		{Literal: "$"},
+	}, tmpl)
+	assert.Equal(t, `$SUBST(2,"_",".")`, tmpl[3].String())
+
+	captures := [][]byte{[]byte("all"), []byte("2"), []byte("4_1"), {0x10, 0x00}}
+	assert.Equal(t, "v2.4.1 16 cost $", tmpl.fill(captures))
+
+	// malformed helpers are kept as text
+	assert.Equal(t, versionTemplate{{Literal: `$P(x) $SUBST(1,"a")`}}, parseTemplate(`$P(x) $SUBST(1,"a")`))
+	// two digit groups are not split
+	assert.Equal(t, "b", parseTemplate("$10").fill(append(make([][]byte, 10), []byte("b"))))
+}
@@ -0,0 +1,277 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrVersionConstraint = errors.New("invalid version constraint")
+
+var (
+	reVersionBuild = regexp.MustCompile(`(?i)[(\[]?\bbuild[\s:#.-]*(\d[\w.-]*)[)\]]?`)
+	reVersionCore  = regexp.MustCompile(`\d`)
+)
+
+// distroHints maps banner fragments to the distribution they imply, first match wins
+var distroHints = []struct {
+	re     *regexp.Regexp
+	distro string
+}{
+	{regexp.MustCompile(`(?i)ubuntu`), "ubuntu"},
+	{regexp.MustCompile(`(?i)raspbian`), "raspbian"},
+	{regexp.MustCompile(`(?i)debian|\+deb\d+`), "debian"},
+	{regexp.MustCompile(`(?i)centos`), "centos"},
+	{regexp.MustCompile(`(?i)red ?hat|rhel|\.el\d+`), "rhel"},
+	{regexp.MustCompile(`(?i)fedora|\.fc\d+`), "fedora"},
+	{regexp.MustCompile(`(?i)suse`), "suse"},
+	{regexp.MustCompile(`(?i)amazon|\.amzn\d*`), "amazon"},
+	{regexp.MustCompile(`(?i)alpine`), "alpine"},
+	{regexp.MustCompile(`(?i)gentoo`), "gentoo"},
+	{regexp.MustCompile(`(?i)freebsd`), "freebsd"},
+	{regexp.MustCompile(`(?i)netbsd`), "netbsd"},
+	{regexp.MustCompile(`(?i)openbsd`), "openbsd"},
+	{regexp.MustCompile(`(?i)win32|win64|windows`), "windows"},
+}
+
+// preReleaseRanks orders the pre-release markers, all of them sort before a
+// release. The single letters only mark a pre-release when digits follow, as in
+// `1.0a1`; a trailing letter is a later release, as in OpenSSL's `1.0.2k`.
+var preReleaseRanks = map[string]int{
+	"dev": -6, "snapshot": -6, "alpha": -5, "a": -5, "beta": -4, "b": -4,
+	"pre": -3, "preview": -3, "c": -2, "rc": -2, "cr": -2,
+}
+
+type versionToken struct {
+	num   uint64
+	alpha string
+	pre   bool
+}
+
+func (t versionToken) isNum() bool {
+	return t.alpha == ""
+}
+
+// Version a free-form banner version split into a comparable core and its hints
+type Version struct {
+	Raw        string `json:"raw"`
+	Normalized string `json:"normalized,omitempty"`
+	Distro     string `json:"distro,omitempty"`
+	Build      string `json:"build,omitempty"`
+	Extra      string `json:"extra,omitempty"`
+
+	tokens []versionToken
+}
+
+// ParsedVersion parses the version field of the version info
+func (v *VInfo) ParsedVersion() *Version {
+	return ParseVersion(v.Version)
+}
+
+// ParseVersion parses nmap banner versions such as `7.4p1 Debian 10+deb9u7`,
+// `2_2_3_578` or `15.0 build 4521`
+func ParseVersion(raw string) *Version {
+	v := &Version{Raw: raw}
+	src := strings.TrimSpace(raw)
+
+	for _, hint := range distroHints {
+		if hint.re.MatchString(src) {
+			v.Distro = hint.distro
+			break
+		}
+	}
+
+	if loc := reVersionBuild.FindStringSubmatchIndex(src); loc != nil {
+		v.Build = src[loc[2]:loc[3]]
+		src = strings.TrimSpace(src[:loc[0]] + " " + src[loc[1]:])
+	}
+
+	// the core version is the first field carrying a digit, the rest is extra text
+	fields := strings.Fields(src)
+	for i, field := range fields {
+		if !reVersionCore.MatchString(field) {
+			continue
+		}
+		v.Normalized = normalizeVersionCore(field)
+		v.Extra = strings.Join(append(append([]string{}, fields[:i]...), fields[i+1:]...), " ")
+		break
+	}
+	if v.Normalized == "" {
+		v.Extra = src
+	}
+	v.tokens = tokenizeVersion(v.Normalized)
+
+	return v
+}
+
+// normalizeVersionCore lower-cases a version field, drops a leading `v`, maps
+// `_` and `,` separators to `.` and strips build metadata after `+`
+func normalizeVersionCore(field string) string {
+	field = strings.ToLower(strings.Trim(field, "()[],;:"))
+	if len(field) > 1 && field[0] == 'v' && field[1] >= '0' && field[1] <= '9' {
+		field = field[1:]
+	}
+	if i := strings.IndexByte(field, '+'); i > 0 {
+		field = field[:i]
+	}
+	field = strings.NewReplacer("_", ".", ",", ".").Replace(field)
+
+	return strings.Trim(field, ".-~")
+}
+
+// tokenizeVersion splits a normalized version into numeric and alphabetic runs
+func tokenizeVersion(s string) []versionToken {
+	var tokens []versionToken
+	for i := 0; i < len(s); {
+		j := i
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			n, err := strconv.ParseUint(s[i:j], 10, 64)
+			if err != nil {
+				n = ^uint64(0)
+			}
+			tokens = append(tokens, versionToken{num: n})
+		case s[i] >= 'a' && s[i] <= 'z':
+			for j < len(s) && s[j] >= 'a' && s[j] <= 'z' {
+				j++
+			}
+			_, pre := preReleaseRanks[s[i:j]]
+			if j-i == 1 && (j == len(s) || s[j] < '0' || s[j] > '9') {
+				pre = false
+			}
+			tokens = append(tokens, versionToken{alpha: s[i:j], pre: pre})
+		default:
+			j++
+		}
+		i = j
+	}
+
+	return tokens
+}
+
+// compareVersionTokens orders two tokens: numbers sort after words, pre-release
+// markers sort before any other word
+func compareVersionTokens(a, b versionToken) int {
+	switch {
+	case a.isNum() && b.isNum():
+		if a.num == b.num {
+			return 0
+		}
+		if a.num < b.num {
+			return -1
+		}
+		return 1
+	case a.isNum():
+		return 1
+	case b.isNum():
+		return -1
+	}
+
+	switch {
+	case a.pre && b.pre:
+		return compareInt(preReleaseRanks[a.alpha], preReleaseRanks[b.alpha])
+	case a.pre:
+		return -1
+	case b.pre:
+		return 1
+	}
+
+	return strings.Compare(a.alpha, b.alpha)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is older, equal or newer than o.
+// Only the normalized core takes part; distro, build and extra text are ignored.
+func (v *Version) Compare(o *Version) int {
+	a, b := v.tokens, o.tokens
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if ret := compareVersionTokens(a[i], b[i]); ret != 0 {
+			return ret
+		}
+	}
+
+	switch {
+	case len(a) > len(b):
+		return compareVersionTail(a[len(b):])
+	case len(a) < len(b):
+		return -compareVersionTail(b[len(a):])
+	}
+
+	return 0
+}
+
+// compareVersionTail decides how a longer version relates to its prefix:
+// `1.0rc1` is older than `1.0`, `1.0p1` is newer, `1.0.0` equals it
+func compareVersionTail(tail []versionToken) int {
+	for _, t := range tail {
+		switch {
+		case t.pre:
+			return -1
+		case !t.isNum() || t.num != 0:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// CompareVersions parses and compares two banner versions
+func CompareVersions(a, b string) int {
+	return ParseVersion(a).Compare(ParseVersion(b))
+}
+
+// Satisfies checks the version against comma separated constraints such as `< 8.0`
+// or `>= 7.4, < 8.0`; all of them have to hold
+func (v *Version) Satisfies(constraints string) (bool, error) {
+	if v.Normalized == "" {
+		return false, nil
+	}
+
+	for _, constraint := range strings.Split(constraints, ",") {
+		constraint = strings.TrimSpace(constraint)
+		op := strings.TrimRight(constraint[:len(constraint)-len(strings.TrimLeft(constraint, "<>=!~^"))], " ")
+		target := strings.TrimSpace(constraint[len(op):])
+		if target == "" {
+			return false, errors.WithMessage(ErrVersionConstraint, constraint)
+		}
+
+		ret := v.Compare(ParseVersion(target))
+		ok := false
+		switch op {
+		case "<":
+			ok = ret < 0
+		case "<=":
+			ok = ret <= 0
+		case ">":
+			ok = ret > 0
+		case ">=":
+			ok = ret >= 0
+		case "", "=", "==":
+			ok = ret == 0
+		case "!=":
+			ok = ret != 0
+		default:
+			return false, errors.WithMessage(ErrVersionConstraint, constraint)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
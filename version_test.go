@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	v := ParseVersion("7.4p1 Debian 10+deb9u7")
+	assert.Equal(t, "7.4p1", v.Normalized)
+	assert.Equal(t, "debian", v.Distro)
+	assert.Equal(t, "Debian 10+deb9u7", v.Extra)
+
+	v = ParseVersion("2_2_3_578")
+	assert.Equal(t, "2.2.3.578", v.Normalized)
+
+	v = ParseVersion("15.0 (build 4521)")
+	assert.Equal(t, "15.0", v.Normalized)
+	assert.Equal(t, "4521", v.Build)
+
+	v = ParseVersion("v1.18.0-beta2")
+	assert.Equal(t, "1.18.0-beta2", v.Normalized)
+
+	v = ParseVersion("2.4.29 ((Ubuntu))")
+	assert.Equal(t, "2.4.29", v.Normalized)
+	assert.Equal(t, "ubuntu", v.Distro)
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, -1, CompareVersions("7.4p1 Debian 10+deb9u7", "8.0"))
+	assert.Equal(t, 1, CompareVersions("2.4.29", "2.4.9"))
+	assert.Equal(t, -1, CompareVersions("1.0rc1", "1.0"))
+	assert.Equal(t, -1, CompareVersions("1.0beta", "1.0rc1"))
+	assert.Equal(t, 1, CompareVersions("7.4p1", "7.4"))
+	assert.Equal(t, 0, CompareVersions("8.0.0", "8.0"))
+	assert.Equal(t, 0, CompareVersions("2_2_3_578", "2.2.3.578"))
+	assert.Equal(t, -1, CompareVersions("1.0a1", "1.0"))
+	assert.Equal(t, -1, CompareVersions("1.0b2", "1.0rc1"))
+
+	// OpenSSL letter releases and OpenSSH portable releases follow the base release
+	assert.Equal(t, 1, CompareVersions("1.0.2a", "1.0.2"))
+	assert.Equal(t, 1, CompareVersions("1.0.2c", "1.0.2"))
+	assert.Equal(t, 1, CompareVersions("0.9.8b", "0.9.8"))
+	assert.Equal(t, -1, CompareVersions("1.0.2a", "1.0.2k"))
+	assert.Equal(t, -1, CompareVersions("1.0.2k", "1.1.0"))
+	assert.Equal(t, -1, CompareVersions("7.4p1", "7.4p2"))
+	assert.Equal(t, -1, CompareVersions("7.9p1", "8.0p1"))
+}
+
+func TestVersionSatisfies(t *testing.T) {
+	v := (&VInfo{Version: "7.4p1 Debian 10+deb9u7"}).ParsedVersion()
+
+	ok, err := v.Satisfies("< 8.0")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = v.Satisfies(">= 7.4, < 7.4p1")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = (&VInfo{Version: "1.0.2c"}).ParsedVersion().Satisfies("< 1.0.2k")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	_, err = v.Satisfies("~> 7.0")
+	assert.ErrorIs(t, err, ErrVersionConstraint)
+}
@@ -0,0 +1,249 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/randolphcyg/cpe"
+)
+
+const probeSeparator = "##############################NEXT PROBE##############################"
+
+// delimiterCandidates the delimiters tried in order when a value contains the preferred one
+const delimiterCandidates = "|/=%@#!~^;,:"
+
+var ErrNoDelimiter = errors.New("no delimiter available for value")
+
+// pickDelimiter returns the preferred delimiter if value does not contain it,
+// otherwise the first candidate absent from value
+func pickDelimiter(value string, preferred byte) (byte, error) {
+	if strings.IndexByte(value, preferred) == -1 {
+		return preferred, nil
+	}
+
+	for i := 0; i < len(delimiterCandidates); i++ {
+		if strings.IndexByte(value, delimiterCandidates[i]) == -1 {
+			return delimiterCandidates[i], nil
+		}
+	}
+
+	return 0, errors.WithMessage(ErrNoDelimiter, value)
+}
+
+// writeDelimited writes `<delim>value<delim>`
+func writeDelimited(sb *strings.Builder, value string, preferred byte) error {
+	delim, err := pickDelimiter(value, preferred)
+	if err != nil {
+		return err
+	}
+
+	sb.WriteByte(delim)
+	sb.WriteString(value)
+	sb.WriteByte(delim)
+
+	return nil
+}
+
+// formatCPETemplate renders a CPE of a match line without any escaping, so
+// placeholders such as `$1` or `$SUBST(1,"_",".")` are kept as written
+func formatCPETemplate(c *cpe.CPE) string {
+	return joinCPE22(cpeAttributes(c))
+}
+
+// formatCPEURIs renders the CPEs of version info as they are written in a
+// match line, such as `cpe:/a:openbsd:openssh:$SUBST(2,"_",".")/a`
+func formatCPEURIs(v *VInfo) []string {
+	uris := make([]string, 0, len(v.Cpe))
+	for i, c := range v.Cpe {
+		uri := "cpe:/" + formatCPETemplate(c)
+		if i < len(v.CpeFlags) && v.CpeFlags[i] != "" {
+			uri += "/" + v.CpeFlags[i]
+		}
+		uris = append(uris, uri)
+	}
+
+	return uris
+}
+
+// formatVInfo renders the version info part of a match line
+func formatVInfo(v *VInfo) (string, error) {
+	var sb strings.Builder
+	for _, flag := range vInfoFields {
+		value := *v.vInfoField(flag)
+		if value == "" {
+			continue
+		}
+
+		sb.WriteByte(' ')
+		sb.WriteByte(flag)
+		if err := writeDelimited(&sb, value, '/'); err != nil {
+			return "", err
+		}
+	}
+
+	for i, item := range v.Cpe {
+		if item == nil {
+			continue
+		}
+
+		sb.WriteString(" cpe:")
+		if err := writeDelimited(&sb, formatCPETemplate(item), '/'); err != nil {
+			return "", err
+		}
+		if i < len(v.CpeFlags) {
+			sb.WriteString(v.CpeFlags[i])
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// formatMatchLine renders a match rule as a `match` or `softmatch` line
+func formatMatchLine(m *Match) (string, error) {
+	var sb strings.Builder
+	if m.Soft {
+		sb.WriteString("softmatch ")
+	} else {
+		sb.WriteString("match ")
+	}
+	sb.WriteString(m.Name)
+	sb.WriteString(" m")
+	if err := writeDelimited(&sb, m.Pattern, '|'); err != nil {
+		return "", err
+	}
+	sb.WriteString(m.PatternFlag)
+
+	if m.VersionInfo != nil {
+		vInfo, err := formatVInfo(m.VersionInfo)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(vInfo)
+	}
+
+	return sb.String(), nil
+}
+
+// formatProbeLine renders the `Probe` line of a probe
+func formatProbeLine(p *Probe) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("Probe ")
+	sb.WriteString(p.Protocol)
+	sb.WriteByte(' ')
+	sb.WriteString(p.ProbeName)
+	sb.WriteString(" q")
+	if err := writeDelimited(&sb, p.ProbeString, '|'); err != nil {
+		return "", err
+	}
+	if p.NoPayload {
+		sb.WriteString(" no-payload")
+	}
+
+	return sb.String(), nil
+}
+
+// formatComment renders a comment block as `#` lines
+func formatComment(comment string) []string {
+	if comment == "" {
+		return nil
+	}
+
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = "#"
+			continue
+		}
+		lines[i] = "# " + line
+	}
+
+	return lines
+}
+
+// writeProbe writes a probe with its directives and match rules
+func writeProbe(w *bufio.Writer, p *Probe) error {
+	probeLine, err := formatProbeLine(p)
+	if err != nil {
+		return errors.WithMessage(err, p.ProbeName)
+	}
+
+	lines := append([]string{probeSeparator}, formatComment(p.Comment)...)
+	lines = append(lines, probeLine)
+	directives := []struct {
+		name  string
+		value string
+	}{
+		{"rarity", p.Rarity},
+		{"ports", strings.Join(p.Ports, ",")},
+		{"sslports", strings.Join(p.SslPorts, ",")},
+		{"totalwaitms", p.TotalWaitMs},
+		{"tcpwrappedms", p.TcpWrappedMs},
+		{"fallback", p.Fallback},
+	}
+	for _, directive := range directives {
+		if directive.value != "" {
+			lines = append(lines, directive.name+" "+directive.value)
+		}
+	}
+	lines = append(lines, "")
+
+	for _, m := range p.Matches {
+		matchLine, err := formatMatchLine(m)
+		if err != nil {
+			return errors.WithMessage(err, p.ProbeName)
+		}
+		lines = append(lines, formatComment(m.Comment)...)
+		lines = append(lines, matchLine)
+	}
+
+	for _, line := range lines {
+		if _, err = w.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteNmapServiceProbe serialize probes back to the nmap-service-probes format
+func (c *Client) WriteNmapServiceProbe(w io.Writer, probes []*Probe) error {
+	bw := bufio.NewWriter(w)
+	if err := writeProbes(bw, probes); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// WriteProbeDB serialize a probe database, including its Exclude directive,
+// to the nmap-service-probes format
+func (c *Client) WriteProbeDB(w io.Writer, db *ProbeDB) error {
+	bw := bufio.NewWriter(w)
+	if len(db.Exclude) > 0 {
+		if _, err := bw.WriteString("Exclude " + strings.Join(db.Exclude, ",") + "\n\n"); err != nil {
+			return err
+		}
+	}
+	if err := writeProbes(bw, db.Probes); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+func writeProbes(w *bufio.Writer, probes []*Probe) error {
+	for i, p := range probes {
+		if i > 0 {
+			if _, err := w.WriteString("\n"); err != nil {
+				return err
+			}
+		}
+		if err := writeProbe(w, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMatchLine(t *testing.T) {
+	lines := []string{
+		`match ftp m|^220 ([-/.+\w]+) IBM TCP/IP for OS/2 - FTP Server| p|IBM OS/2 ftpd| o|OS/2| h/$1/ cpe:/a:ibm:os2_ftp_server/ cpe:/o:ibm:os2/`,
+		`match avg m=^220-AVG daemon mode scanner \((?:AVG|SMTP)\)\r\n=s p/AVG daemon mode/ cpe:/o:microsoft:windows/a`,
+		`softmatch ssh m|^SSH-([\d.]+)-|i i/protocol $1/`,
+	}
+
+	for _, line := range lines {
+		m, err := client.ParseMatch(line)
+		assert.Nil(t, err)
+
+		out, err := formatMatchLine(m)
+		assert.Nil(t, err)
+
+		reparsed, err := client.ParseMatch(out)
+		assert.Nil(t, err)
+		assert.Equal(t, m, reparsed)
+	}
+
+	m, _ := client.ParseMatch(lines[1])
+	assert.Equal(t, `^220-AVG daemon mode scanner \((?:AVG|SMTP)\)\r\n`, m.Pattern)
+	assert.Equal(t, "s", m.PatternFlag)
+	assert.Equal(t, []string{"a"}, m.VersionInfo.CpeFlags)
+
+	m, _ = client.ParseMatch(lines[2])
+	assert.True(t, m.Soft)
+}
+
+func TestWriteNmapServiceProbeRoundTrip(t *testing.T) {
+	srcFilePath := "./tests/nmap-service-probes"
+	probes, err := client.ParseNmapServiceProbe(srcFilePath)
+	assert.Nil(t, err)
+
+	var sb strings.Builder
+	assert.Nil(t, client.WriteNmapServiceProbe(&sb, probes))
+
+	dstFilePath := filepath.Join(t.TempDir(), "nmap-service-probes")
+	assert.Nil(t, os.WriteFile(dstFilePath, []byte(sb.String()), 0644))
+
+	reparsed, err := client.ParseNmapServiceProbe(dstFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, clearSourcePositions(probes), clearSourcePositions(reparsed))
+}
+
+// clearSourcePositions drops the file and line fields, which differ between the original and the written file
+func clearSourcePositions(probes []*Probe) []*Probe {
+	for _, p := range probes {
+		p.Source, p.Line, p.DirectiveLines = "", 0, nil
+		for _, m := range p.Matches {
+			m.Source, m.Line = "", 0
+		}
+	}
+
+	return probes
+}